@@ -5,15 +5,25 @@ import (
 	"context"
 	"github.com/jmoiron/sqlx"
 	v1 "github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/locationgrp"
+	"github.com/mchusovlianov/geodata/business/core/geo"
+	"github.com/mchusovlianov/geodata/foundation/debug"
 	"github.com/mchusovlianov/geodata/foundation/web"
 	"github.com/mchusovlianov/geodata/foundation/web/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"net/http"
+	"net/netip"
 )
 
 // Options represent optional parameters.
 type Options struct {
-	corsOrigin string
+	corsOrigin   string
+	lookupMaxIPs int
+	geo          geo.Querier
+	trusted      []netip.Prefix
+	metrics      prometheus.Registerer
 }
 
 // WithCORS provides configuration options for CORS.
@@ -23,15 +33,58 @@ func WithCORS(origin string) func(opts *Options) {
 	}
 }
 
+// WithLookupMaxIPs limits the number of ip-addresses in one lookup request.
+func WithLookupMaxIPs(max int) func(opts *Options) {
+	return func(opts *Options) {
+		opts.lookupMaxIPs = max
+	}
+}
+
+// WithGeo serves location lookups by ip from the querier, e.g. an in-memory
+// index, instead of the database.
+func WithGeo(querier geo.Querier) func(opts *Options) {
+	return func(opts *Options) {
+		opts.geo = querier
+	}
+}
+
+// WithTrustedProxies trusts the forwarding headers of requests coming from the
+// prefixes when looking up the caller's location.
+func WithTrustedProxies(prefixes []netip.Prefix) func(opts *Options) {
+	return func(opts *Options) {
+		opts.trusted = prefixes
+	}
+}
+
+// WithMetrics records metrics of the requests into collectors registered with
+// reg.
+func WithMetrics(reg prometheus.Registerer) func(opts *Options) {
+	return func(opts *Options) {
+		opts.metrics = reg
+	}
+}
+
+// DebugMux constructs a http.Handler with the debug routes: profiles, published
+// variables and the metrics of the gatherer in the Prometheus text format.
+func DebugMux(gatherer prometheus.Gatherer) http.Handler {
+	mux := debug.Mux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	return mux
+}
+
 // APIMuxConfig contains all the mandatory systems required by handlers.
 type APIMuxConfig struct {
-	Log *zap.SugaredLogger
-	DB  *sqlx.DB
+	Build string
+	Log   *zap.SugaredLogger
+	DB    *sqlx.DB
 }
 
 // APIMux constructs a http.Handler with all application routes defined.
 func APIMux(cfg APIMuxConfig, options ...func(opts *Options)) http.Handler {
-	var opts Options
+	opts := Options{
+		lookupMaxIPs: locationgrp.DefaultLookupMaxIPs,
+	}
 	for _, option := range options {
 		option(&opts)
 	}
@@ -39,10 +92,17 @@ func APIMux(cfg APIMuxConfig, options ...func(opts *Options)) http.Handler {
 	// Construct the web.App which holds all routes as well as common Middleware.
 	var app *web.App
 
+	// Do we need metrics? A nil middleware is skipped.
+	var metrics web.Middleware
+	if opts.metrics != nil {
+		metrics = middleware.Metrics(opts.metrics)
+	}
+
 	// Do we need CORS?
 	if opts.corsOrigin != "" {
 		app = web.NewApp(
 			middleware.Logger(cfg.Log),
+			metrics,
 			middleware.Errors(cfg.Log),
 			middleware.Cors(opts.corsOrigin),
 			middleware.Panics(),
@@ -60,6 +120,7 @@ func APIMux(cfg APIMuxConfig, options ...func(opts *Options)) http.Handler {
 	if app == nil {
 		app = web.NewApp(
 			middleware.Logger(cfg.Log),
+			metrics,
 			middleware.Errors(cfg.Log),
 			middleware.Panics(),
 		)
@@ -67,8 +128,13 @@ func APIMux(cfg APIMuxConfig, options ...func(opts *Options)) http.Handler {
 
 	// Load the v1 routes.
 	v1.Routes(app, v1.Config{
-		Log: cfg.Log,
-		DB:  cfg.DB,
+		Build:        cfg.Build,
+		Log:          cfg.Log,
+		DB:           cfg.DB,
+		LookupMaxIPs: opts.lookupMaxIPs,
+		Geo:          opts.geo,
+
+		TrustedProxies: opts.trusted,
 	})
 
 	return app
@@ -0,0 +1,71 @@
+// Package checkgrp maintains the group of handlers for health checking.
+package checkgrp
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+)
+
+// readinessTimeout bounds how long the readiness check waits for the database.
+const readinessTimeout = time.Second
+
+// Handlers manages the set of check endpoints.
+type Handlers struct {
+	Build string
+	Log   *zap.SugaredLogger
+	DB    *sqlx.DB
+}
+
+// Readiness checks if the database is ready and if not will return a 500 status.
+// Do not respond by just returning an error because further up in the call
+// stack it will interpret that as a non-trusted error.
+func (h Handlers) Readiness(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	status := "ok"
+	statusCode := http.StatusOK
+	if err := database.StatusCheck(ctx, h.DB); err != nil {
+		h.Log.Errorw("readiness", "ERROR", err)
+		status = "db not ready"
+		statusCode = http.StatusInternalServerError
+	}
+
+	data := struct {
+		Status string `json:"status"`
+	}{
+		Status: status,
+	}
+
+	return web.Respond(ctx, w, data, statusCode)
+}
+
+// Liveness returns simple status info if the service is alive. It doesn't check
+// the database, so a slow database doesn't get the service restarted.
+func (h Handlers) Liveness(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unavailable"
+	}
+
+	data := struct {
+		Status     string `json:"status"`
+		Build      string `json:"build"`
+		Host       string `json:"host"`
+		GOMAXPROCS int    `json:"GOMAXPROCS"`
+	}{
+		Status:     "up",
+		Build:      h.Build,
+		Host:       host,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+
+	return web.Respond(ctx, w, data, http.StatusOK)
+}
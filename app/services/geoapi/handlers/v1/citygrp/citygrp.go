@@ -0,0 +1,33 @@
+package citygrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"net/http"
+)
+
+// Handlers manages the set of city endpoints.
+type Handlers struct {
+	City city.Core
+}
+
+// QueryByUUID returns the city with the uuid.
+func (h Handlers) QueryByUUID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	cityUUID := web.Param(r, "uuid")
+
+	c, err := h.City.QueryByUUID(ctx, cityUUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, city.ErrNotFound):
+			return web.NewRequestError(err, http.StatusNotFound)
+
+		default:
+			return fmt.Errorf("UUID[%s]: %w", cityUUID, err)
+		}
+	}
+
+	return web.Respond(ctx, w, c, http.StatusOK)
+}
@@ -0,0 +1,98 @@
+package countrygrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/data/page"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"net/http"
+)
+
+// defaultLimit is the page of countries or cities when the request doesn't
+// specify it.
+const defaultLimit = 100
+
+// Handlers manages the set of country endpoints.
+type Handlers struct {
+	Country country.Core
+	City    city.Core
+}
+
+// Query returns a page of countries sorted by the sort parameter, name or code
+// with a leading '-' for the descending order. The cursor parameter asks for
+// the next page.
+func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	q, err := page.ParseQuery(r.URL.Query(), "name", defaultLimit)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	countries, err := h.Country.Query(ctx, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, country.ErrValidation):
+			return web.NewRequestError(err, http.StatusBadRequest)
+
+		default:
+			return fmt.Errorf("query[%+v]: %w", q, err)
+		}
+	}
+
+	return web.Respond(ctx, w, countries, http.StatusOK)
+}
+
+// QueryByCode returns the country with the code.
+func (h Handlers) QueryByCode(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	code := web.Param(r, "code")
+
+	c, err := h.Country.QueryByCode(ctx, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, country.ErrNotFound):
+			return web.NewRequestError(err, http.StatusNotFound)
+
+		default:
+			return fmt.Errorf("code[%s]: %w", code, err)
+		}
+	}
+
+	return web.Respond(ctx, w, c, http.StatusOK)
+}
+
+// QueryCities returns a page of cities of the country with the code sorted by
+// the sort parameter, name or -name. The cursor parameter asks for the next page.
+func (h Handlers) QueryCities(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	code := web.Param(r, "code")
+
+	q, err := page.ParseQuery(r.URL.Query(), "name", defaultLimit)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	c, err := h.Country.QueryByCode(ctx, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, country.ErrNotFound):
+			return web.NewRequestError(err, http.StatusNotFound)
+
+		default:
+			return fmt.Errorf("code[%s]: %w", code, err)
+		}
+	}
+
+	cities, err := h.City.QueryByCountry(ctx, c.UUID, q)
+	if err != nil {
+		switch {
+		case errors.Is(err, city.ErrValidation):
+			return web.NewRequestError(err, http.StatusBadRequest)
+
+		default:
+			return fmt.Errorf("code[%s] query[%+v]: %w", code, q, err)
+		}
+	}
+
+	return web.Respond(ctx, w, cities, http.StatusOK)
+}
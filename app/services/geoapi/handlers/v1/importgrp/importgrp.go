@@ -0,0 +1,64 @@
+package importgrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mchusovlianov/geodata/business/core/importrun"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"net/http"
+	"strconv"
+)
+
+// Default page of runs when the request doesn't specify it.
+const (
+	defaultPage = 1
+	defaultRows = 20
+)
+
+// Handlers manages the set of import endpoints.
+type Handlers struct {
+	Run importrun.Core
+}
+
+// Query returns a page of import runs, the most recent first.
+func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	pageNumber, err := queryInt(r, "page", defaultPage)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	rowsPerPage, err := queryInt(r, "rows", defaultRows)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	runs, err := h.Run.Query(ctx, pageNumber, rowsPerPage)
+	if err != nil {
+		switch {
+		case errors.Is(err, importrun.ErrValidation):
+			return web.NewRequestError(err, http.StatusBadRequest)
+
+		default:
+			return fmt.Errorf("page[%d] rows[%d]: %w", pageNumber, rowsPerPage, err)
+		}
+	}
+
+	return web.Respond(ctx, w, runs, http.StatusOK)
+}
+
+// queryInt returns the integer value of the query parameter or the default
+// value if the parameter is missing.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s format: %s", key, value)
+	}
+
+	return n, nil
+}
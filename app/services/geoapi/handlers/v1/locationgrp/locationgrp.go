@@ -6,35 +6,73 @@ import (
 	"fmt"
 	"github.com/mchusovlianov/geodata/business/core/city"
 	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/geo"
 	"github.com/mchusovlianov/geodata/business/core/location"
 	"github.com/mchusovlianov/geodata/foundation/web"
+	"math"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 )
 
+// DefaultLookupMaxIPs is the number of ip-addresses allowed in one lookup
+// request when it isn't configured.
+const DefaultLookupMaxIPs = 1000
+
+// Defaults of nearby searches when the request doesn't specify them.
+const (
+	defaultRadiusKm = 50
+	defaultLimit    = 10
+)
+
+// defaultBoxLimit is the page of a box search when the request doesn't specify it.
+const defaultBoxLimit = 100
+
+// maxIPLen bounds the length of an ip-address in a lookup request body, it
+// leaves room for the quotes and the separator.
+const maxIPLen = 64
+
 // Handlers manages the set of location endpoints.
 type Handlers struct {
 	Location location.Core
-	Country  country.Core
-	City     city.Core
+	Geo      geo.Querier
+	MaxIPs   int
+
+	// TrustedProxies are the peers whose forwarding headers tell the caller's IP.
+	TrustedProxies []netip.Prefix
 }
 
-// LocationResponse
+// LocationResponse is a location with its city and country.
 type LocationResponse struct {
 	Location location.Location `json:"location"`
 	Country  country.Country   `json:"country"`
 	City     city.City         `json:"city"`
 }
 
-// QueryByID returns a location by its IP.
+// QueryByIP returns a location with its city and country by its IP.
 func (h Handlers) QueryByIP(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	ip := web.Param(r, "ip")
+	return h.respondByIP(ctx, w, web.Param(r, "ip"))
+}
+
+// QueryMe returns the location of the caller's IP with its city and country.
+func (h Handlers) QueryMe(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ip, err := web.ClientIP(r, h.TrustedProxies)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
 
-	loc, err := h.Location.QueryByIP(ctx, ip)
+	return h.respondByIP(ctx, w, ip.String())
+}
+
+// respondByIP responds with the location of the IP with its city and country.
+func (h Handlers) respondByIP(ctx context.Context, w http.ResponseWriter, ip string) error {
+	g, err := h.Geo.QueryByIP(ctx, ip)
 	if err != nil {
 		switch {
-		case errors.Is(err, location.ErrNotFound):
+		case errors.Is(err, geo.ErrNotFound):
 			return web.NewRequestError(err, http.StatusNotFound)
-		case errors.Is(err, location.ErrValidation):
+		case errors.Is(err, geo.ErrValidation):
 			return web.NewRequestError(err, http.StatusBadRequest)
 
 		default:
@@ -42,35 +80,178 @@ func (h Handlers) QueryByIP(ctx context.Context, w http.ResponseWriter, r *http.
 		}
 	}
 
-	cit, err := h.City.QueryByUUID(ctx, loc.CityUUID)
+	return web.Respond(ctx, w, LocationResponse(g), http.StatusOK)
+}
+
+// QueryNearby returns the locations with their cities and countries around the
+// position of the lat and lon parameters, the closest first.
+func (h Handlers) QueryNearby(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Query().Get("lat") == "" || r.URL.Query().Get("lon") == "" {
+		return web.NewRequestError(errors.New("lat and lon are required"), http.StatusBadRequest)
+	}
+
+	lat, err := queryFloat(r, "lat", 0)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	lon, err := queryFloat(r, "lon", 0)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	radiusKm, err := queryFloat(r, "radius_km", defaultRadiusKm)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	limit, err := queryInt(r, "limit", defaultLimit)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	geos, err := h.Geo.QueryNearby(ctx, lat, lon, radiusKm, limit)
 	if err != nil {
 		switch {
-		case errors.Is(err, city.ErrNotFound):
-			return web.NewRequestError(err, http.StatusNotFound)
-		case errors.Is(err, city.ErrValidation):
-			return web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, geo.ErrValidation):
+			return web.NewRequestError(fmt.Errorf("%w: lat must be within ±90, lon within ±180, radius_km within (0, %d] and limit within [1, %d]", err, geo.MaxNearbyRadiusKm, geo.MaxNearbyLimit), http.StatusBadRequest)
 
 		default:
-			return fmt.Errorf("UUID[%s]: %w", loc.CityUUID, err)
+			return fmt.Errorf("lat[%f] lon[%f] radius[%f]: %w", lat, lon, radiusKm, err)
 		}
 	}
 
-	countr, err := h.Country.QueryByUUID(ctx, cit.CountryUUID)
+	return web.Respond(ctx, w, geos, http.StatusOK)
+}
+
+// QueryByBox returns a page of locations inside the box given as the bbox
+// parameter minLon,minLat,maxLon,maxLat, optionally of the country with the code
+// of the country parameter. The cursor parameter asks for the next page.
+func (h Handlers) QueryByBox(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	box, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	limit, err := queryInt(r, "limit", defaultBoxLimit)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	countryCode := r.URL.Query().Get("country")
+	cursor := r.URL.Query().Get("cursor")
+
+	page, err := h.Location.QueryByBox(ctx, box, countryCode, cursor, limit)
 	if err != nil {
 		switch {
-		case errors.Is(err, country.ErrNotFound):
-			return web.NewRequestError(err, http.StatusNotFound)
-		case errors.Is(err, country.ErrValidation):
-			return web.NewRequestError(err, http.StatusBadRequest)
+		case errors.Is(err, location.ErrValidation):
+			return web.NewRequestError(fmt.Errorf("%w: bbox must be within ±180 and ±90 with minLat not above maxLat, limit within [1, %d] and cursor from a previous page", err, location.MaxBoxLimit), http.StatusBadRequest)
 
 		default:
-			return fmt.Errorf("UUID[%s]: %w", cit.CountryUUID, err)
+			return fmt.Errorf("bbox[%+v]: %w", box, err)
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// LookupResult is the result of a single ip-address of a lookup request. It has
+// either the location with its city and country or the error.
+type LookupResult struct {
+	IP       string             `json:"ip"`
+	Location *location.Location `json:"location,omitempty"`
+	Country  *country.Country   `json:"country,omitempty"`
+	City     *city.City         `json:"city,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// Lookup returns the locations of a JSON array of IPs in the order of the
+// array. Malformed and unknown IPs get an error of their own.
+func (h Handlers) Lookup(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.MaxIPs+1)*maxIPLen)
+
+	var ips []string
+	if err := web.Decode(r, &ips); err != nil {
+		return web.NewRequestError(fmt.Errorf("expected a JSON array of at most %d ips: %w", h.MaxIPs, err), http.StatusBadRequest)
+	}
+
+	switch {
+	case len(ips) == 0:
+		return web.NewRequestError(errors.New("no ips to look up"), http.StatusBadRequest)
+	case len(ips) > h.MaxIPs:
+		return web.NewRequestError(fmt.Errorf("too many ips: %d, at most %d are allowed", len(ips), h.MaxIPs), http.StatusBadRequest)
+	}
+
+	lookups, err := h.Geo.QueryByIPs(ctx, ips)
+	if err != nil {
+		return fmt.Errorf("IPs[%d]: %w", len(ips), err)
+	}
+
+	results := make([]LookupResult, len(lookups))
+	for i, lookup := range lookups {
+		results[i].IP = lookup.IP
+
+		if lookup.Err != nil {
+			results[i].Error = lookup.Err.Error()
+			continue
+		}
+
+		g := lookup.Geo
+		results[i].Location = &g.Location
+		results[i].City = &g.City
+		results[i].Country = &g.Country
+	}
+
+	return web.Respond(ctx, w, results, http.StatusOK)
+}
+
+// queryFloat returns the number value of the query parameter or the default
+// value if the parameter is missing.
+func queryFloat(r *http.Request, key string, def float64) (float64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid %s format: %s", key, value)
+	}
+
+	return n, nil
+}
+
+// queryInt returns the integer value of the query parameter or the default
+// value if the parameter is missing.
+func queryInt(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s format: %s", key, value)
+	}
+
+	return n, nil
+}
+
+// parseBBox parses a box given as minLon,minLat,maxLon,maxLat.
+func parseBBox(value string) (location.BBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return location.BBox{}, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat: %q", value)
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return location.BBox{}, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat: %q", value)
 		}
+		coords[i] = n
 	}
 
-	return web.Respond(ctx, w, LocationResponse{
-		Location: loc,
-		Country:  countr,
-		City:     cit,
-	}, http.StatusOK)
+	return location.BBox{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}, nil
 }
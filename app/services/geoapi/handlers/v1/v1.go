@@ -3,12 +3,19 @@
 package v1
 
 import (
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/checkgrp"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/citygrp"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/countrygrp"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/importgrp"
 	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/locationgrp"
 	"github.com/mchusovlianov/geodata/business/core/city"
 	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/geo"
+	"github.com/mchusovlianov/geodata/business/core/importrun"
 	"github.com/mchusovlianov/geodata/business/core/location"
 	"github.com/mchusovlianov/geodata/foundation/web"
 	"net/http"
+	"net/netip"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -16,19 +23,64 @@ import (
 
 // Config contains all the mandatory systems required by handlers.
 type Config struct {
-	Log *zap.SugaredLogger
-	DB  *sqlx.DB
+	Build        string
+	Log          *zap.SugaredLogger
+	DB           *sqlx.DB
+	LookupMaxIPs int
+	Geo          geo.Querier // Optional, the database is queried if not set.
+
+	TrustedProxies []netip.Prefix
 }
 
 // Routes binds all the version 1 routes.
 func Routes(app *web.App, cfg Config) {
 	const version = "v1"
 
+	geoQuerier := cfg.Geo
+	if geoQuerier == nil {
+		geoQuerier = geo.NewCore(cfg.Log, cfg.DB, nil)
+	}
+
+	// Register health check endpoints.
+	chkh := checkgrp.Handlers{
+		Build: cfg.Build,
+		Log:   cfg.Log,
+		DB:    cfg.DB,
+	}
+	app.Handle(http.MethodGet, version, "/readiness", chkh.Readiness)
+	app.Handle(http.MethodGet, version, "/liveness", chkh.Liveness)
+
 	// Register user management and authentication endpoints.
 	loch := locationgrp.Handlers{
 		Location: location.NewCore(cfg.Log, cfg.DB, nil),
-		Country:  country.NewCore(cfg.Log, cfg.DB, nil),
-		City:     city.NewCore(cfg.Log, cfg.DB, nil),
+		Geo:      geoQuerier,
+		MaxIPs:   cfg.LookupMaxIPs,
+
+		TrustedProxies: cfg.TrustedProxies,
 	}
+	app.Handle(http.MethodGet, version, "/location/me", loch.QueryMe)
 	app.Handle(http.MethodGet, version, "/location/:ip", loch.QueryByIP)
+	app.Handle(http.MethodPost, version, "/locations/lookup", loch.Lookup)
+	app.Handle(http.MethodGet, version, "/locations/nearby", loch.QueryNearby)
+	app.Handle(http.MethodGet, version, "/locations", loch.QueryByBox)
+
+	// Register country and city endpoints.
+	cnth := countrygrp.Handlers{
+		Country: country.NewCore(cfg.Log, cfg.DB, nil),
+		City:    city.NewCore(cfg.Log, cfg.DB, nil),
+	}
+	app.Handle(http.MethodGet, version, "/countries", cnth.Query)
+	app.Handle(http.MethodGet, version, "/countries/:code", cnth.QueryByCode)
+	app.Handle(http.MethodGet, version, "/countries/:code/cities", cnth.QueryCities)
+
+	cith := citygrp.Handlers{
+		City: city.NewCore(cfg.Log, cfg.DB, nil),
+	}
+	app.Handle(http.MethodGet, version, "/cities/:uuid", cith.QueryByUUID)
+
+	// Register import history endpoints.
+	imph := importgrp.Handlers{
+		Run: importrun.NewCore(cfg.Log, cfg.DB, nil),
+	}
+	app.Handle(http.MethodGet, version, "/imports", imph.Query)
 }
@@ -1,23 +1,41 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers"
+	"github.com/mchusovlianov/geodata/business/core/geo"
 	"github.com/mchusovlianov/geodata/foundation/database"
 	"go.uber.org/zap/zapcore"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/ardanlabs/conf/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
 )
 
 const serviceName = "geodata-api"
 
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
+
 func newLogger() (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout"}
@@ -77,6 +95,8 @@ func run(log *zap.SugaredLogger) error {
 			IdleTimeout     time.Duration `conf:"default:120s"`
 			ShutdownTimeout time.Duration `conf:"default:20s"`
 			APIHost         string        `conf:"default:0.0.0.0:3000"`
+			DebugHost       string        `conf:"default:0.0.0.0:4000"`
+			TrustedProxies  []string      `conf:"help:addresses or CIDR blocks of proxies whose forwarding headers are trusted"`
 		}
 		DB struct {
 			User         string `conf:"default:root"`
@@ -86,6 +106,24 @@ func run(log *zap.SugaredLogger) error {
 			MaxIdleConns int    `conf:"default:0"`
 			MaxOpenConns int    `conf:"default:0"`
 		}
+		Lookup struct {
+			MaxIPs int `conf:"default:1000,help:maximum number of ip-addresses in one lookup request"`
+		}
+		Index struct {
+			Enabled bool `conf:"default:false,help:serve lookups by ip from memory"`
+		}
+		Cache struct {
+			Size int           `conf:"default:10000,help:number of lookups by ip to cache; 0 disables the cache"`
+			TTL  time.Duration `conf:"default:5m"`
+		}
+		Dataset struct {
+			CheckInterval time.Duration `conf:"default:1m,help:how often to check for a new generation of the dataset"`
+		}
+		Tracing struct {
+			Exporter    string  `conf:"default:none,help:where spans are exported: none, stdout or otlp"`
+			Endpoint    string  `conf:"default:localhost:4318,help:host and port of the OTLP/HTTP collector"`
+			Probability float64 `conf:"default:0.05,help:share of traces started by the api which are sampled"`
+		}
 	}{}
 
 	const prefix = "GEOAPI"
@@ -101,7 +139,7 @@ func run(log *zap.SugaredLogger) error {
 	// =========================================================================
 	// App Starting
 
-	log.Infow("starting service")
+	log.Infow("starting service", "version", build)
 	defer log.Infow("shutdown complete")
 
 	out, err := conf.String(&cfg)
@@ -133,16 +171,114 @@ func run(log *zap.SugaredLogger) error {
 		db.Close()
 	}()
 
+	// =========================================================================
+	// Start Tracing Support
+
+	log.Infow("startup", "status", "initializing tracing support", "exporter", cfg.Tracing.Exporter)
+
+	traceProvider, err := startTracing(cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.Probability)
+	if err != nil {
+		return fmt.Errorf("starting tracing: %w", err)
+	}
+	defer func() {
+		log.Infow("shutdown", "status", "stopping tracing support")
+		traceProvider.Shutdown(context.Background())
+	}()
+
+	// =========================================================================
+	// Metrics
+
+	// Metrics of the service are prefixed, the standard ones of the runtime,
+	// the process and the database pool are not.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db.DB, cfg.DB.Name),
+	)
+	apiReg := prometheus.WrapRegistererWithPrefix("geoapi_", reg)
+
+	// =========================================================================
+	// Lookup Index And Cache
+
+	// The index and the cache are reloaded and purged when an import makes
+	// another generation of the dataset live.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var querier geo.Querier
+	var watch func(ctx context.Context, interval time.Duration)
+
+	// without the cache its collectors stay at zero, so dashboards and alerts
+	// don't have to tell a missing series from an unused cache.
+	cacheStats := func() geo.CacheStats { return geo.CacheStats{} }
+
+	if cfg.Index.Enabled {
+		log.Infow("startup", "status", "loading in-memory index")
+
+		index := geo.NewIndex(log, db)
+		if err := index.Load(ctx); err != nil {
+			return fmt.Errorf("loading index: %w", err)
+		}
+		querier, watch = index, index.Watch
+	}
+
+	if cfg.Cache.Size > 0 {
+		if querier == nil {
+			querier = geo.NewCore(log, db, nil)
+		}
+
+		cache := geo.NewCache(log, db, querier, cfg.Cache.Size, cfg.Cache.TTL)
+		querier, watch, cacheStats = cache, cache.Watch, cache.Stats
+	}
+	apiReg.MustRegister(cacheCollectors(cacheStats)...)
+
+	trusted, err := parsePrefixes(cfg.Web.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+
+	muxOptions := []func(opts *handlers.Options){
+		handlers.WithLookupMaxIPs(cfg.Lookup.MaxIPs),
+		handlers.WithTrustedProxies(trusted),
+		handlers.WithMetrics(apiReg),
+	}
+	if querier != nil {
+		go watch(ctx, cfg.Dataset.CheckInterval)
+		muxOptions = append(muxOptions, handlers.WithGeo(querier))
+	}
+
+	// =========================================================================
+	// Start Debug Service
+
+	log.Infow("startup", "status", "debug router started", "host", cfg.Web.DebugHost)
+
+	expvar.NewString("build").Set(build)
+
+	// The debug server listens apart from the api, so profiles and metrics
+	// aren't exposed with it. Not concerned with shutting this down with the api.
+	go func() {
+		if err := http.ListenAndServe(cfg.Web.DebugHost, handlers.DebugMux(reg)); err != nil {
+			log.Errorw("shutdown", "status", "debug router closed", "host", cfg.Web.DebugHost, "ERROR", err)
+		}
+	}()
+
 	// =========================================================================
 	// Start API Service
 
 	log.Infow("startup", "status", "initializing V1 API support")
 
+	// Make a channel to listen for an interrupt or terminate signal from the OS.
+	// Use a buffered channel because the signal package requires it.
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
 	// Construct the mux for the API calls.
 	apiMux := handlers.APIMux(handlers.APIMuxConfig{
-		Log: log,
-		DB:  db,
-	})
+		Build: build,
+		Log:   log,
+		DB:    db,
+	}, muxOptions...)
 
 	// Construct a server to service the requests against the mux.
 	api := http.Server{
@@ -154,9 +290,115 @@ func run(log *zap.SugaredLogger) error {
 		ErrorLog:     zap.NewStdLog(log.Desugar()),
 	}
 
+	// Make a channel to listen for errors coming from the listener. Use a
+	// buffered channel so the goroutine can exit if we don't collect this error.
+	serverErrors := make(chan error, 1)
+
 	// Start the service listening for api requests.
-	log.Infow("startup", "status", "api router started", "host", api.Addr)
-	api.ListenAndServe()
+	go func() {
+		log.Infow("startup", "status", "api router started", "host", api.Addr)
+		serverErrors <- api.ListenAndServe()
+	}()
+
+	// =========================================================================
+	// Shutdown
+
+	// Blocking main and waiting for shutdown.
+	select {
+	case err := <-serverErrors:
+		return fmt.Errorf("server error: %w", err)
+
+	case sig := <-shutdown:
+		log.Infow("shutdown", "status", "shutdown started", "signal", sig)
+
+		// Give outstanding requests a deadline for completion.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
+		defer cancel()
+
+		// Asking listener to shut down and shed load.
+		if err := api.Shutdown(ctx); err != nil {
+			api.Close()
+			return fmt.Errorf("could not stop server gracefully: %w", err)
+		}
+	}
 
 	return nil
 }
+
+// startTracing sets the global tracer provider exporting the spans to stdout or
+// an OTLP collector, the spans are dropped with the none exporter. A trace
+// continued from a caller follows its sampling decision.
+func startTracing(exporter string, endpoint string, probability float64) (*sdktrace.TracerProvider, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(probability))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(build),
+		)),
+	}
+
+	switch exporter {
+	case "none":
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("creating stdout exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	case "otlp":
+		exp, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", exporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp, nil
+}
+
+// cacheCollectors exposes the statistics of the cache of lookups by ip.
+func cacheCollectors(stats func() geo.CacheStats) []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "lookup_cache_hits_total",
+			Help: "Lookups by ip answered by the cache.",
+		}, func() float64 { return float64(stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "lookup_cache_misses_total",
+			Help: "Lookups by ip passed by the cache to the index or the database.",
+		}, func() float64 { return float64(stats().Misses) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "lookup_cache_size",
+			Help: "Number of cached lookups by ip.",
+		}, func() float64 { return float64(stats().Size) }),
+	}
+}
+
+// parsePrefixes parses CIDR blocks, a single address is a block of its own.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
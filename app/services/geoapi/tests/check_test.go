@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// CheckTests holds methods for each health check subtest.
+type CheckTests struct {
+	app     http.Handler
+	offline http.Handler // uses a database nobody listens to.
+	metered http.Handler // records metrics into reg.
+	reg     *prometheus.Registry
+}
+
+// TestChecks is the entry point for testing health checks.
+func TestChecks(t *testing.T) {
+	test := tests.NewIntegration(
+		t,
+		tests.DBContainer{
+			Image: "percona",
+			Port:  "3306",
+			Name:  "geodatacheckstest",
+			Args:  []string{"-e", "MYSQL_ROOT_PASSWORD=root"},
+		},
+	)
+	t.Cleanup(test.Teardown)
+
+	offlineDB, err := database.Open(database.Config{User: "root", Password: "root", Host: "127.0.0.1:1", Name: "geodata"})
+	if err != nil {
+		t.Fatalf("Can't open the offline database %s", err)
+	}
+	t.Cleanup(func() { offlineDB.Close() })
+
+	reg := prometheus.NewRegistry()
+
+	tests := CheckTests{
+		app: handlers.APIMux(handlers.APIMuxConfig{
+			Build: "test",
+			Log:   test.Log,
+			DB:    test.DB,
+		}),
+		offline: handlers.APIMux(handlers.APIMuxConfig{
+			Build: "test",
+			Log:   test.Log,
+			DB:    offlineDB,
+		}),
+		metered: handlers.APIMux(handlers.APIMuxConfig{
+			Log: test.Log,
+			DB:  offlineDB,
+		}, handlers.WithMetrics(reg)),
+		reg: reg,
+	}
+
+	t.Run("getReadiness200", tests.getReadiness200)
+	t.Run("getReadiness500", tests.getReadiness500)
+	t.Run("getLiveness200", tests.getLiveness200)
+	t.Run("getMetrics200", tests.getMetrics200)
+	t.Run("getRequestID", tests.getRequestID)
+	t.Run("getTraceContext", tests.getTraceContext)
+}
+
+// getReadiness200 validates the readiness of a service with its database up.
+func (ct *CheckTests) getReadiness200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/readiness", nil)
+	w := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate the readiness of the service.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the database is up.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getReadiness500 validates the readiness of a service with its database down.
+func (ct *CheckTests) getReadiness500(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/readiness", nil)
+	w := httptest.NewRecorder()
+
+	ct.offline.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate the readiness of the service.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the database is down.", testID)
+		{
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 500 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 500 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getLiveness200 validates the liveness of a service reports its build.
+func (ct *CheckTests) getLiveness200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/liveness", nil)
+	w := httptest.NewRecorder()
+
+	ct.offline.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate the liveness of the service.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the database is down.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got struct {
+				Status     string `json:"status"`
+				Build      string `json:"build"`
+				GOMAXPROCS int    `json:"GOMAXPROCS"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if got.Status != "up" || got.Build != "test" || got.GOMAXPROCS < 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould report the build of the live service. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the build of the live service.", tests.Success, testID)
+		}
+	}
+}
+
+// getMetrics200 validates the metrics of requests are exposed by route and
+// status code.
+func (ct *CheckTests) getMetrics200(t *testing.T) {
+	for _, path := range []string{"/v1/liveness", "/v1/readiness", "/v1/readiness"} {
+		ct.metered.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+
+	handlers.DebugMux(ct.reg).ServeHTTP(w, r)
+
+	t.Log("Given the need to validate the metrics of requests.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the routes were requested.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			for _, line := range []string{
+				`http_requests_total{code="200",method="GET",route="/v1/liveness"} 1`,
+				`http_requests_total{code="500",method="GET",route="/v1/readiness"} 2`,
+				`http_request_duration_seconds_count{method="GET",route="/v1/readiness"} 2`,
+			} {
+				if !strings.Contains(w.Body.String(), line) {
+					t.Fatalf("\t%s\tTest %d:\tShould expose %s. Got:\n%s", tests.Failed, testID, line, w.Body.String())
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould expose the requests by route and status code.", tests.Success, testID)
+		}
+	}
+}
+
+// getRequestID validates a request id sent by the client is echoed and a new
+// one is made for requests without a usable one.
+func (ct *CheckTests) getRequestID(t *testing.T) {
+	t.Log("Given the need to correlate responses with requests.")
+	{
+		for testID, tt := range []struct {
+			id   string
+			kept bool
+		}{
+			{"5f1c-proxy-id", true},
+			{"", false},
+			{"two words", false},
+			{strings.Repeat("x", 129), false},
+		} {
+			r := httptest.NewRequest(http.MethodGet, "/v1/liveness", nil)
+			r.Header.Set(web.RequestIDHeader, tt.id)
+			w := httptest.NewRecorder()
+
+			ct.offline.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen sending the request id %q.", testID, tt.id)
+			{
+				got := w.Header().Get(web.RequestIDHeader)
+				if got == "" || (got == tt.id) != tt.kept {
+					t.Fatalf("\t%s\tTest %d:\tShould echo the request id only if it is usable. Got %q.", tests.Failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould echo the request id only if it is usable.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// getTraceContext validates a request continues the trace of its caller.
+func (ct *CheckTests) getTraceContext(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/liveness", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+
+	ct.offline.ServeHTTP(w, r)
+
+	t.Log("Given the need to follow a request across services.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sending a W3C traceparent header.", testID)
+		{
+			if got := w.Header().Get(web.RequestIDHeader); got != traceID {
+				t.Fatalf("\t%s\tTest %d:\tShould use the trace id of the caller as the request id. Got %q.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the trace id of the caller as the request id.", tests.Success, testID)
+		}
+	}
+}
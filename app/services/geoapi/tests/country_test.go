@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/data/page"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Seeded country and city.
+const (
+	seedCountryCode = "AL"
+	seedCityUUID    = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+)
+
+// CountryTests holds methods for each country and city subtest.
+type CountryTests struct {
+	app http.Handler
+}
+
+// TestCountries is the entry point for testing country and city functions.
+func TestCountries(t *testing.T) {
+	test := tests.NewIntegration(
+		t,
+		tests.DBContainer{
+			Image:  "percona",
+			Port:   "3306",
+			Name:   "geodatacountriestest",
+			IsSeed: true,
+			Args:   []string{"-e", "MYSQL_ROOT_PASSWORD=root"},
+		},
+	)
+	t.Cleanup(test.Teardown)
+
+	tests := CountryTests{
+		app: handlers.APIMux(handlers.APIMuxConfig{
+			Log: test.Log,
+			DB:  test.DB,
+		}),
+	}
+
+	t.Run("getCountries400", tests.getCountries400)
+	t.Run("getCountries200", tests.getCountries200)
+	t.Run("getCountry404", tests.getCountry404)
+	t.Run("getCountry200", tests.getCountry200)
+	t.Run("getCities200", tests.getCities200)
+	t.Run("getCity404", tests.getCity404)
+	t.Run("getCity200", tests.getCity200)
+}
+
+// getCountries400 validates country pages with an unknown sort field, a limit
+// out of range or a malformed cursor.
+func (ct *CountryTests) getCountries400(t *testing.T) {
+	t.Log("Given the need to validate malformed country pages.")
+	{
+		for testID, query := range []string{"sort=date_created", "limit=0", "limit=1001", "limit=x", "cursor=!"} {
+			r := httptest.NewRequest(http.MethodGet, "/v1/countries?"+query, nil)
+			w := httptest.NewRecorder()
+
+			ct.app.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen using the query %s.", testID, query)
+			{
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// getCountries200 validates country pages sorted by each field.
+func (ct *CountryTests) getCountries200(t *testing.T) {
+	t.Log("Given the need to page through countries.")
+	{
+		for testID, query := range []string{"", "sort=-name", "sort=code&limit=1"} {
+			r := httptest.NewRequest(http.MethodGet, "/v1/countries?"+query, nil)
+			w := httptest.NewRecorder()
+
+			ct.app.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen using the query %s.", testID, query)
+			{
+				if w.Code != http.StatusOK {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+				}
+
+				var got page.Page[country.Country]
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+				}
+
+				if len(got.Items) != 1 || got.Total != 1 || got.NextCursor != "" || got.Items[0].Code != seedCountryCode {
+					t.Fatalf("\t%s\tTest %d:\tShould get the seeded country on a single page. Got %+v.", tests.Failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the seeded country on a single page.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// getCountry404 validates a country request for an unknown code.
+func (ct *CountryTests) getCountry404(t *testing.T) {
+	for _, path := range []string{"/v1/countries/NL", "/v1/countries/NL/cities"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+
+		ct.app.ServeHTTP(w, r)
+
+		t.Logf("Given the need to validate getting %s of an unknown country.", path)
+		{
+			testID := 0
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getCountry200 validates a country request for an existing code.
+func (ct *CountryTests) getCountry200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/countries/"+seedCountryCode, nil)
+	w := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting a country that exists.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the code %s.", testID, seedCountryCode)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+
+			var got country.Country
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if got.Code != seedCountryCode {
+				t.Fatalf("\t%s\tTest %d:\tShould get the country with the code. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the country with the code.", tests.Success, testID)
+		}
+	}
+}
+
+// getCities200 validates a page of cities of a country.
+func (ct *CountryTests) getCities200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/countries/"+seedCountryCode+"/cities?sort=-name", nil)
+	w := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to page through cities of a country.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the code %s.", testID, seedCountryCode)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+
+			var got page.Page[city.City]
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if len(got.Items) != 1 || got.Total != 1 || got.Items[0].UUID != seedCityUUID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the seeded city on a single page. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the seeded city on a single page.", tests.Success, testID)
+		}
+	}
+}
+
+// getCity404 validates a city request for an unknown uuid.
+func (ct *CountryTests) getCity404(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/cities/00000000-0000-0000-0000-000000000000", nil)
+	w := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting a city that does not exist.")
+	{
+		testID := 0
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for the response : %v", tests.Failed, testID, w.Code)
+		}
+		t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for the response.", tests.Success, testID)
+	}
+}
+
+// getCity200 validates a city request for an existing uuid.
+func (ct *CountryTests) getCity200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/cities/"+seedCityUUID, nil)
+	w := httptest.NewRecorder()
+
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting a city that exists.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the uuid %s.", testID, seedCityUUID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+
+			var got city.City
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if got.UUID != seedCityUUID || got.Name != "Test city #1" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the city with the uuid. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the city with the uuid.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers"
+	"github.com/mchusovlianov/geodata/business/core/importrun"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ImportTests holds methods for each import subtest.
+type ImportTests struct {
+	app http.Handler
+	run importrun.Run
+}
+
+// TestImports is the entry point for testing import history functions.
+func TestImports(t *testing.T) {
+	test := tests.NewIntegration(
+		t,
+		tests.DBContainer{
+			Image: "percona",
+			Port:  "3306",
+			Name:  "geodataimportstest",
+			Args:  []string{"-e", "MYSQL_ROOT_PASSWORD=root"},
+		},
+	)
+	t.Cleanup(test.Teardown)
+
+	runCore := importrun.NewCore(test.Log, test.DB, nil)
+	run, err := runCore.Create(context.Background(), importrun.NewRun{FileName: "data.csv", Checksum: "sum"}, time.Now())
+	if err != nil {
+		t.Fatalf("Can't create a run %s", err)
+	}
+
+	tests := ImportTests{
+		app: handlers.APIMux(handlers.APIMuxConfig{
+			Log: test.Log,
+			DB:  test.DB,
+		}),
+		run: run,
+	}
+
+	t.Run("getImports400", tests.getImports400)
+	t.Run("getImports200", tests.getImports200)
+}
+
+// getImports400 validates an imports request for a page which is too big.
+func (it *ImportTests) getImports400(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/imports?rows=1000", nil)
+	w := httptest.NewRecorder()
+
+	it.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting imports with a wrong page size.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen asking for 1000 rows.", testID)
+		{
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getImports200 validates an imports request returning the recorded runs.
+func (it *ImportTests) getImports200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/imports", nil)
+	w := httptest.NewRecorder()
+
+	it.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting the history of imports.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a run was recorded.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got []importrun.Run
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if len(got) != 1 || got[0].UUID != it.run.UUID || got[0].Status != importrun.StatusRunning {
+				t.Fatalf("\t%s\tTest %d:\tShould get the recorded run. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the recorded run.", tests.Success, testID)
+		}
+	}
+}
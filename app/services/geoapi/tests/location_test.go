@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers"
 	"github.com/mchusovlianov/geodata/app/services/geoapi/handlers/v1/locationgrp"
+	"github.com/mchusovlianov/geodata/business/core/geo"
+	"github.com/mchusovlianov/geodata/business/core/location"
 	"github.com/mchusovlianov/geodata/business/data/tests"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -17,7 +21,8 @@ import (
 // dependencies for tests while still providing a convenient syntax when
 // subtests are registered.
 type LocationTests struct {
-	app http.Handler
+	app     http.Handler
+	proxied http.Handler // trusts the forwarding headers of httptest requests.
 }
 
 // TestLocations is the entry point for testing location management functions.
@@ -39,11 +44,22 @@ func TestLocations(t *testing.T) {
 			Log: test.Log,
 			DB:  test.DB,
 		}),
+		proxied: handlers.APIMux(handlers.APIMuxConfig{
+			Log: test.Log,
+			DB:  test.DB,
+		}, handlers.WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})),
 	}
 
 	t.Run("getLocation400", tests.getLocation400)
 	t.Run("getLocation404", tests.getLocation404)
 	t.Run("getLocation200", tests.getLocation200)
+	t.Run("getMe404", tests.getMe404)
+	t.Run("getMe200", tests.getMe200)
+	t.Run("getNearby400", tests.getNearby400)
+	t.Run("getNearby200", tests.getNearby200)
+	t.Run("getBox200", tests.getBox200)
+	t.Run("postLookup400", tests.postLookup400)
+	t.Run("postLookup200", tests.postLookup200)
 }
 
 // getLocation400 validates a location request for a malformed ip.
@@ -127,3 +143,217 @@ func (lt *LocationTests) getLocation200(t *testing.T) {
 		}
 	}
 }
+
+// getMe404 validates that the forwarding headers of an untrusted peer are ignored.
+func (lt *LocationTests) getMe404(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/location/me", nil)
+	r.Header.Set("X-Forwarded-For", "32.123.12.2")
+	w := httptest.NewRecorder()
+
+	lt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting the location of an untrusted caller.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen calling from %s.", testID, r.RemoteAddr)
+		{
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getMe200 validates getting the location of a caller behind a trusted proxy.
+func (lt *LocationTests) getMe200(t *testing.T) {
+	ip := "32.123.12.2"
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/location/me", nil)
+	r.Header.Set("X-Forwarded-For", ip+", 192.0.2.10")
+	w := httptest.NewRecorder()
+
+	lt.proxied.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate getting the location of a caller behind proxies.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen calling from %s through %s.", testID, ip, r.RemoteAddr)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got locationgrp.LocationResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if got.Location.IP != ip {
+				t.Fatalf("\t%s\tTest %d:\tShould get the location of the caller. Got %s.", tests.Failed, testID, got.Location.IP)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the location of the caller.", tests.Success, testID)
+		}
+	}
+}
+
+// getNearby400 validates nearby searches with missing or malformed parameters.
+func (lt *LocationTests) getNearby400(t *testing.T) {
+	queries := []string{"lat=-50", "lat=-50&lon=abc", "lat=-50&lon=54&radius_km=5000", "lat=-50&lon=54&limit=0"}
+
+	t.Log("Given the need to validate malformed nearby searches.")
+	{
+		for testID, query := range queries {
+			r := httptest.NewRequest(http.MethodGet, "/v1/locations/nearby?"+query, nil)
+			w := httptest.NewRecorder()
+
+			lt.app.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen using the query %s.", testID, query)
+			{
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// getNearby200 validates a nearby search around the seeded location.
+func (lt *LocationTests) getNearby200(t *testing.T) {
+	query := "lat=-50.1&lon=54.3&radius_km=20"
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/locations/nearby?"+query, nil)
+	w := httptest.NewRecorder()
+
+	lt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to search locations near a position.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the query %s.", testID, query)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got []geo.NearbyGeo
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if len(got) != 1 || got[0].Location.IP != "32.123.12.2" || got[0].Country.UUID != "77eabf6e-30a8-44d0-8952-029d2ca06872" {
+				t.Fatalf("\t%s\tTest %d:\tShould find the seeded location. Got %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the seeded location.", tests.Success, testID)
+		}
+	}
+}
+
+// getBox200 validates searches of locations inside a box of a country.
+func (lt *LocationTests) getBox200(t *testing.T) {
+	t.Log("Given the need to search locations inside a box.")
+	{
+		for testID, tt := range []struct {
+			query string
+			found int
+		}{
+			{"bbox=54,-51,55,-50&country=AL", 1},
+			{"bbox=54,-51,55,-50&country=NL", 0},
+			{"bbox=55,-51,54,-50", 0},
+		} {
+			r := httptest.NewRequest(http.MethodGet, "/v1/locations?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			lt.app.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen using the query %s.", testID, tt.query)
+			{
+				if w.Code != http.StatusOK {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+				}
+
+				var got location.LocationPage
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+				}
+
+				if len(got.Locations) != tt.found || got.NextCursor != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould find %d locations on a single page. Got %+v.", tests.Failed, testID, tt.found, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould find %d locations on a single page.", tests.Success, testID, tt.found)
+			}
+		}
+	}
+}
+
+// postLookup400 validates lookup requests without ips, with too many of them or
+// with a malformed body.
+func (lt *LocationTests) postLookup400(t *testing.T) {
+	tooMany, _ := json.Marshal(make([]string, locationgrp.DefaultLookupMaxIPs+1))
+	bodies := []string{`[]`, string(tooMany), `{"ip": "32.123.12.2"}`}
+
+	t.Log("Given the need to validate malformed lookup requests.")
+	{
+		for testID, body := range bodies {
+			r := httptest.NewRequest(http.MethodPost, "/v1/locations/lookup", strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			lt.app.ServeHTTP(w, r)
+
+			t.Logf("\tTest %d:\tWhen using a body of %d bytes.", testID, len(body))
+			{
+				if w.Code != http.StatusBadRequest {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// postLookup200 validates a lookup request with known, unknown and malformed ips.
+func (lt *LocationTests) postLookup200(t *testing.T) {
+	body := `["32.123.12.2", "123.12.12.2", "12345", "::ffff:32.123.12.2"]`
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/locations/lookup", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	lt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to look up many ips at once.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the ips %s.", testID, body)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got []locationgrp.LookupResult
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+
+			if len(got) != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould get a result per ip. Got %d.", tests.Failed, testID, len(got))
+			}
+
+			for _, i := range []int{0, 3} {
+				if got[i].Location == nil || got[i].Location.IP != "32.123.12.2" || got[i].City == nil || got[i].City.UUID != "45b5fbd3-755f-4379-8f07-a58d4a30fa2f" || got[i].Country == nil || got[i].Country.UUID != "77eabf6e-30a8-44d0-8952-029d2ca06872" {
+					t.Fatalf("\t%s\tTest %d:\tShould find the location of %s. Got %+v.", tests.Failed, testID, got[i].IP, got[i])
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the locations of known ips.", tests.Success, testID)
+
+			if got[1].Location != nil || got[1].Error == "" || got[2].Location != nil || got[2].Error == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get errors for unknown and malformed ips. Got %+v.", tests.Failed, testID, got[1:3])
+			}
+			t.Logf("\t%s\tTest %d:\tShould get errors for unknown and malformed ips.", tests.Success, testID)
+		}
+	}
+}
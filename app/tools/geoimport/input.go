@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stdinPath is the file path which makes geoimport read the csv from stdin.
+const stdinPath = "-"
+
+// Set of compression formats of the input.
+const (
+	compressionNone  = ""
+	compressionGzip  = "gzip"
+	compressionZstd  = "zstd"
+	compressionBzip2 = "bzip2"
+)
+
+// magics maps compression formats to the bytes their streams start with.
+var magics = []struct {
+	compression string
+	magic       []byte
+}{
+	{compressionGzip, []byte{0x1f, 0x8b}},
+	{compressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{compressionBzip2, []byte("BZh")},
+}
+
+// extensions maps file extensions to the compression they stand for.
+var extensions = map[string]string{
+	".gz":  compressionGzip,
+	".zst": compressionZstd,
+	".bz2": compressionBzip2,
+}
+
+// input is the csv content to import, decompressed if it was compressed.
+type input struct {
+	name        string
+	checksum    string
+	compression string
+	reader      io.Reader
+	closers     []io.Closer
+	file        *os.File
+	hash        hash.Hash // hash of the raw bytes read so far, nil if the checksum is known.
+}
+
+// openInput opens the file or stdin and wraps it with a decompressor detected
+// by magic bytes. If asked, the checksum is calculated over the raw file before
+// the import, e.g. to compare it with the one of the run to resume. Otherwise
+// the file is hashed while it is read, see sum. Stdin can't be read twice, so
+// it gets no checksum and can't be resumed.
+func openInput(path string, withChecksum bool) (input, error) {
+	in := input{
+		name: "stdin",
+	}
+
+	var raw io.Reader = os.Stdin
+	if path != stdinPath {
+		f, err := os.Open(path)
+		if err != nil {
+			return input{}, fmt.Errorf("can't open file: %w", err)
+		}
+		in.closers = append(in.closers, f)
+
+		in.name = filepath.Base(path)
+		in.file = f
+		raw = f
+
+		if withChecksum {
+			sum, err := checksum(f)
+			if err != nil {
+				in.Close()
+				return input{}, fmt.Errorf("can't calculate checksum: %w", err)
+			}
+			in.checksum = sum
+		} else {
+			in.hash = sha256.New()
+			raw = io.TeeReader(f, in.hash)
+		}
+	}
+
+	br := bufio.NewReaderSize(raw, 1<<20)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		in.Close()
+		return input{}, fmt.Errorf("can't read file: %w", err)
+	}
+	in.compression = detectCompression(head)
+
+	// an extension promising compression must agree with the content
+	if expected, ok := extensions[strings.ToLower(filepath.Ext(path))]; ok && expected != in.compression {
+		in.Close()
+		return input{}, fmt.Errorf("file has %s extension, but its content is not %s", filepath.Ext(path), expected)
+	}
+
+	switch in.compression {
+	case compressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			in.Close()
+			return input{}, fmt.Errorf("can't read gzip: %w", err)
+		}
+		in.closers = append(in.closers, zr)
+		in.reader = zr
+
+	case compressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			in.Close()
+			return input{}, fmt.Errorf("can't read zstd: %w", err)
+		}
+		in.closers = append(in.closers, zr.IOReadCloser())
+		in.reader = zr
+
+	case compressionBzip2:
+		in.reader = bzip2.NewReader(br)
+
+	default:
+		in.reader = br
+	}
+
+	return in, nil
+}
+
+// Close releases the decompressor and the file in reverse order.
+func (in input) Close() error {
+	var first error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if err := in.closers[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// sum returns the checksum of the raw file hashed while it was read. The part
+// the import didn't read, e.g. because it failed, is hashed first.
+func (in input) sum() (string, error) {
+	if _, err := io.Copy(in.hash, in.file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(in.hash.Sum(nil)), nil
+}
+
+// detectCompression returns the compression format the content starts with.
+func detectCompression(head []byte) string {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.compression
+		}
+	}
+
+	return compressionNone
+}
+
+// checksum calculates sha256 of the file content and rewinds the file back to
+// its beginning.
+func checksum(f *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -3,21 +3,36 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"flag"
 	"fmt"
 	"github.com/ardanlabs/conf/v3"
 	"github.com/mchusovlianov/geodata/business/core/importer"
 	"github.com/mchusovlianov/geodata/business/data/dbschema"
+	"github.com/mchusovlianov/geodata/business/data/generation"
 	"github.com/mchusovlianov/geodata/foundation/database"
+	"github.com/mchusovlianov/geodata/foundation/debug"
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"sort"
+	"syscall"
+	"time"
 )
 
 const serviceName = "data-importer"
 
+// build is the git version of this program. It is set using build flags in the makefile.
+var build = "develop"
+
+// exitInterrupted is the exit code of an import stopped by a signal.
+const exitInterrupted = 130
+
 func newLogger() (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout"}
@@ -43,18 +58,39 @@ func main() {
 	}
 	defer log.Sync()
 
-	var filePath string
-	flag.StringVar(&filePath, "filepath", "", "")
+	var filePath, rejectsPath string
+	var rollback, resume, dryRun, delta, deleteMissing bool
+	flag.StringVar(&filePath, "filepath", "", "csv file to import, optionally compressed with gzip, zstd or bzip2; '-' reads stdin")
+	flag.StringVar(&rejectsPath, "rejects", "", "write failed lines with their line number and reason to this csv file")
+	flag.BoolVar(&rollback, "rollback", false, "make the previous generation of the dataset live again")
+	flag.BoolVar(&resume, "resume", false, "continue an interrupted import of the same file from its last checkpoint")
+	flag.BoolVar(&delta, "delta", false, "upsert locations by ip into the live records instead of replacing them")
+	flag.BoolVar(&deleteMissing, "delete-missing", false, "with -delta, delete locations with ips absent from the file")
+	flag.BoolVar(&dryRun, "dry-run", false, "only parse and validate the file, the database is not touched")
 	flag.Parse()
 
+	// Cancel the import on Ctrl-C or when the orchestrator stops the container.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Once the import is cancelled, a second signal kills an import which is
+	// stuck while it stops.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// Perform the startup and shutdown sequence.
-	if err := run(log, filePath); err != nil {
+	if err := run(ctx, log, filePath, rejectsPath, rollback, resume, dryRun, delta, deleteMissing); err != nil {
 		fmt.Println(err)
 		log.Sync()
+		if errors.Is(err, importer.ErrInterrupted) {
+			os.Exit(exitInterrupted)
+		}
 		os.Exit(1)
 	}
 }
-func run(log *zap.SugaredLogger, filePath string) error {
+func run(ctx context.Context, log *zap.SugaredLogger, filePath string, rejectsPath string, rollback bool, resume bool, dryRun bool, delta bool, deleteMissing bool) error {
 	// =========================================================================
 	// GOMAXPROCS
 
@@ -79,7 +115,17 @@ func run(log *zap.SugaredLogger, filePath string) error {
 			MaxIdleConns int    `conf:"default:0"`
 			MaxOpenConns int    `conf:"default:0"`
 		}
-		WorkersCount int `conf:"default:8""`
+		CSV struct {
+			Aliases          map[string]string `conf:"help:header aliases as alias:field pairs separated by ';'"`
+			IgnoreExtra      bool              `conf:"default:true"`
+			Delimiter        string            `conf:"help:single character or 'tab'; comma if empty"`
+			LazyQuotes       bool
+			TrimLeadingSpace bool
+		}
+		WorkersCount    int    `conf:"default:8"`
+		BatchSize       int    `conf:"default:500"`
+		CheckpointEvery int    `conf:"default:100000"`
+		DebugHost       string `conf:"help:host of the listener serving pprof and expvar, e.g. 0.0.0.0:4000; disabled if empty"`
 	}{}
 
 	const prefix = "GEOIMPORT"
@@ -98,6 +144,92 @@ func run(log *zap.SugaredLogger, filePath string) error {
 	}
 	log.Infow("startup", "config", out)
 
+	// =========================================================================
+	// Start Debug Service
+
+	expvar.NewString("build").Set(build)
+
+	// The debug server lets a live import be profiled. Not concerned with
+	// shutting this down when the import is done.
+	if cfg.DebugHost != "" {
+		go func() {
+			log.Infow("startup", "status", "debug router started", "host", cfg.DebugHost)
+			if err := http.ListenAndServe(cfg.DebugHost, debug.Mux()); err != nil {
+				log.Errorw("shutdown", "status", "debug router closed", "host", cfg.DebugHost, "ERROR", err)
+			}
+		}()
+	}
+
+	// =========================================================================
+	// importer options
+	delimiter, err := parseDelimiter(cfg.CSV.Delimiter)
+	if err != nil {
+		return fmt.Errorf("parsing csv delimiter: %w", err)
+	}
+
+	options := []func(opts *importer.Options){
+		importer.WithBatchSize(cfg.BatchSize),
+		importer.WithCheckpointEvery(cfg.CheckpointEvery),
+		importer.WithMapping(importer.Mapping{
+			Aliases:          cfg.CSV.Aliases,
+			IgnoreExtra:      cfg.CSV.IgnoreExtra,
+			Delimiter:        delimiter,
+			LazyQuotes:       cfg.CSV.LazyQuotes,
+			TrimLeadingSpace: cfg.CSV.TrimLeadingSpace,
+		}),
+	}
+
+	if deleteMissing && !delta {
+		return errors.New("-delete-missing requires -delta")
+	}
+	if delta {
+		options = append(options, importer.WithDelta(deleteMissing))
+	}
+
+	if rejectsPath != "" {
+		rf, err := os.Create(rejectsPath)
+		if err != nil {
+			return fmt.Errorf("can't create rejects file: %w", err)
+		}
+		defer rf.Close()
+
+		options = append(options, importer.WithRejects(rf))
+	}
+
+	// =========================================================================
+	// validate the file without touching the database
+	if dryRun {
+		in, err := openInput(filePath, false)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		log.Infow("startup", "input", in.name, "compression", in.compression)
+
+		importerCore, err := importer.NewCore(log, nil, nil, append(options, importer.WithDryRun())...)
+		if err != nil {
+			return fmt.Errorf("creating importer: %w", err)
+		}
+		publishProgress(&importerCore)
+
+		stat, err := importerCore.Import(ctx, importer.Source{
+			Name:   in.name,
+			Reader: in.reader,
+		}, cfg.WorkersCount)
+		if err != nil && !errors.Is(err, importer.ErrInterrupted) {
+			return fmt.Errorf("can't validate: %w", err)
+		}
+
+		out, serr := conf.String(&stat)
+		if serr != nil {
+			return fmt.Errorf("generating validation result for output: %w", serr)
+		}
+		log.Infow("result of dry run", "statistic", out)
+
+		printReasons(os.Stdout, stat)
+		return err
+	}
+
 	// =========================================================================
 	// Database Support
 
@@ -120,36 +252,132 @@ func run(log *zap.SugaredLogger, filePath string) error {
 		db.Close()
 	}()
 
+	// Create connectivity to the staging schema. It is created by the importer,
+	// so the connection must not be used before the import starts.
+	stagingDB, err := database.Open(database.Config{
+		User:         cfg.DB.User,
+		Password:     cfg.DB.Password,
+		Host:         cfg.DB.Host,
+		Name:         cfg.DB.Name + generation.StagingSuffix,
+		MaxIdleConns: cfg.DB.MaxIdleConns,
+		MaxOpenConns: cfg.DB.MaxOpenConns,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to staging db: %w", err)
+	}
+	defer stagingDB.Close()
+
 	// =========================================================================
 	// apply database schema
-	ctx := context.Background()
 	if err := dbschema.Migrate(ctx, db); err != nil {
 		return fmt.Errorf("db schema migration error: %w", err)
 	}
 
+	// =========================================================================
+	// rollback to the previous generation instead of importing
+	if rollback {
+		gen, err := generation.Rollback(ctx, db, time.Now())
+		if err != nil {
+			return fmt.Errorf("rolling back: %w", err)
+		}
+
+		log.Infow("rollback", "generation", gen.ID)
+		return nil
+	}
+
 	// create new importer core
-	importerCore, err := importer.NewCore(log, db)
+	importerCore, err := importer.NewCore(log, db, stagingDB, options...)
 	if err != nil {
 		return fmt.Errorf("creating importer: %w", err)
 	}
+	publishProgress(&importerCore)
 
-	f, err := os.Open(filePath)
+	// only a resume compares the checksum before the import
+	in, err := openInput(filePath, resume)
 	if err != nil {
-		return fmt.Errorf("can't open file: %w", err)
+		return err
 	}
-	defer f.Close()
+	defer in.Close()
+	log.Infow("startup", "input", in.name, "compression", in.compression)
 
-	stat, err := importerCore.Import(ctx, f, cfg.WorkersCount)
-	if err != nil {
-		return fmt.Errorf("can't : %w", err)
+	if resume && in.checksum == "" {
+		log.Infow("stdin can't be resumed, importing from the beginning")
 	}
 
-	out, err = conf.String(&stat)
-	if err != nil {
-		return fmt.Errorf("generating import result for output: %w", err)
+	src := importer.Source{
+		Name:     in.name,
+		Checksum: in.checksum,
+		Reader:   in.reader,
+	}
+	if in.hash != nil {
+		src.Sum = in.sum
+	}
+
+	var stat importer.Statistic
+	switch {
+	case resume:
+		stat, err = importerCore.Resume(ctx, src, cfg.WorkersCount)
+	default:
+		stat, err = importerCore.Import(ctx, src, cfg.WorkersCount)
+	}
+	// an interrupted import still reports what it has done so far
+	if err != nil && !errors.Is(err, importer.ErrInterrupted) {
+		return fmt.Errorf("can't import: %w", err)
+	}
+
+	out, serr := conf.String(&stat)
+	if serr != nil {
+		return fmt.Errorf("generating import result for output: %w", serr)
 	}
 
 	log.Infow("result of import operation ", "statistic", out)
 
-	return nil
+	return err
+}
+
+// publishProgress exposes the progress of the import as the importer variable
+// of /debug/vars.
+func publishProgress(c *importer.Core) {
+	expvar.Publish("importer", expvar.Func(func() any {
+		return c.Progress()
+	}))
+}
+
+// parseDelimiter converts the configured delimiter to a rune. The config can't
+// hold a comma as a default value, so an empty value stands for it.
+func parseDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+
+	runes := []rune(value)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("delimiter must be a single character, got %q", value)
+	}
+
+	return runes[0], nil
+}
+
+// printReasons writes the histogram of failure reasons sorted by count.
+func printReasons(w io.Writer, stat importer.Statistic) {
+	reasons := make([]string, 0, len(stat.FailureReasons))
+	for reason := range stat.FailureReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		ci, cj := stat.FailureReasons[reasons[i]], stat.FailureReasons[reasons[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	fmt.Fprintf(w, "lines: %d, good: %d, failed: %d\n", stat.TotalLines, stat.GoodLines, stat.FailedLines)
+	for _, reason := range reasons {
+		count := stat.FailureReasons[reason]
+		fmt.Fprintf(w, "%-20s %10d %7.2f%%\n", reason, count, 100*float64(count)/float64(stat.FailedLines))
+	}
 }
@@ -11,11 +11,16 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/mchusovlianov/geodata/business/core/city/db"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"time"
 )
 
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/business/core/city")
+
 // Set of error variables for CRUD operations.
 var (
 	ErrNotFound   = errors.New("city not found")
@@ -23,6 +28,11 @@ var (
 	ErrDuplicate  = errors.New("city already exist")
 )
 
+// sortColumns maps the fields cities are sorted by to their columns.
+var sortColumns = map[string]string{
+	"name": "name",
+}
+
 // Core manages the set of APIs for city access.
 type Core struct {
 	store db.Store
@@ -38,6 +48,9 @@ func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, tx *sqlx.Tx) Core {
 // Create adds a City to the database. It returns the created City with
 // fields like ID and DateCreated populated.
 func (c Core) Create(ctx context.Context, city NewCity, now time.Time) (City, error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.create")
+	defer span.End()
+
 	validate := validator.New()
 	err := validate.Struct(city)
 	if err != nil {
@@ -63,8 +76,45 @@ func (c Core) Create(ctx context.Context, city NewCity, now time.Time) (City, er
 	return toCity(dbCity), nil
 }
 
+// CreateBatch adds a set of City records to the database in a single
+// statement. Either all records are created or none of them.
+func (c Core) CreateBatch(ctx context.Context, cities []NewCity, now time.Time) ([]City, error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.createbatch")
+	defer span.End()
+
+	validate := validator.New()
+
+	dbCities := make([]db.City, len(cities))
+	for i, city := range cities {
+		if err := validate.Struct(city); err != nil {
+			return nil, ErrValidation
+		}
+
+		dbCities[i] = db.City{
+			UUID:        uuid.New().String(),
+			CountryUUID: city.CountryUUID,
+			Name:        city.Name,
+			DateCreated: now,
+			DateUpdated: now,
+		}
+	}
+
+	if err := c.store.CreateBatch(ctx, dbCities); err != nil {
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			return nil, ErrDuplicate
+		}
+
+		return nil, fmt.Errorf("create batch: %w", err)
+	}
+
+	return toCitySlice(dbCities), nil
+}
+
 // QueryByUUID gets the specified city from the database.
 func (c Core) QueryByUUID(ctx context.Context, cityUUID string) (City, error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.querybyuuid")
+	defer span.End()
+
 	dbCity, err := c.store.QueryByUUID(ctx, cityUUID)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -78,6 +128,9 @@ func (c Core) QueryByUUID(ctx context.Context, cityUUID string) (City, error) {
 
 // QueryByCountryUUID gets the all cities with same country uuid from the database.
 func (c Core) QueryByCountryUUID(ctx context.Context, countryUUID string) ([]City, error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.querybycountryuuid")
+	defer span.End()
+
 	dbCities, err := c.store.QueryByCountryUUID(ctx, countryUUID)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -89,15 +142,77 @@ func (c Core) QueryByCountryUUID(ctx context.Context, countryUUID string) ([]Cit
 	return toCitySlice(dbCities), nil
 }
 
-// QueryAll gets all cities from the database.
-func (c Core) QueryAll(ctx context.Context) ([]City, error) {
-	dbCities, err := c.store.QueryAll(ctx)
+// QueryByUUIDs gets the specified cities. Unknown identifiers are skipped.
+func (c Core) QueryByUUIDs(ctx context.Context, cityUUIDs []string) ([]City, error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.querybyuuids")
+	defer span.End()
+
+	dbCities, err := c.store.QueryByUUIDs(ctx, cityUUIDs)
 	if err != nil {
-		if errors.Is(err, database.ErrDBNotFound) {
-			return []City{}, ErrNotFound
-		}
-		return []City{}, fmt.Errorf("query: %w", err)
+		return nil, fmt.Errorf("query: %w", err)
 	}
 
 	return toCitySlice(dbCities), nil
 }
+
+// Query gets a page of all cities sorted by name.
+func (c Core) Query(ctx context.Context, q page.Query) (page.Page[City], error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.query")
+	defer span.End()
+
+	return c.query(ctx, q, true)
+}
+
+// QueryPage gets a page of cities like Query does without counting them, the
+// total of the page is zero. It is meant to read all cities page by page.
+func (c Core) QueryPage(ctx context.Context, q page.Query) (page.Page[City], error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.querypage")
+	defer span.End()
+
+	return c.query(ctx, q, false)
+}
+
+// query gets a page of cities, the total is counted only if asked for.
+func (c Core) query(ctx context.Context, q page.Query, count bool) (page.Page[City], error) {
+	ks, err := q.Keyset(sortColumns)
+	if err != nil {
+		return page.Page[City]{}, fmt.Errorf("%w: %s", ErrValidation, err)
+	}
+
+	dbCities, err := c.store.Query(ctx, ks)
+	if err != nil {
+		return page.Page[City]{}, fmt.Errorf("query: %w", err)
+	}
+
+	var total int
+	if count {
+		if total, err = c.store.Count(ctx); err != nil {
+			return page.Page[City]{}, fmt.Errorf("count: %w", err)
+		}
+	}
+
+	return page.New(toCitySlice(dbCities), total, ks, sortKey), nil
+}
+
+// QueryByCountry gets a page of cities of the country sorted by name.
+func (c Core) QueryByCountry(ctx context.Context, countryUUID string, q page.Query) (page.Page[City], error) {
+	ctx, span := tracer.Start(ctx, "business.core.city.querybycountry")
+	defer span.End()
+
+	ks, err := q.Keyset(sortColumns)
+	if err != nil {
+		return page.Page[City]{}, fmt.Errorf("%w: %s", ErrValidation, err)
+	}
+
+	dbCities, err := c.store.QueryByCountry(ctx, countryUUID, ks)
+	if err != nil {
+		return page.Page[City]{}, fmt.Errorf("query: %w", err)
+	}
+
+	total, err := c.store.CountByCountry(ctx, countryUUID)
+	if err != nil {
+		return page.Page[City]{}, fmt.Errorf("count: %w", err)
+	}
+
+	return page.New(toCitySlice(dbCities), total, ks, sortKey), nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/business/data/tests"
 	"github.com/mchusovlianov/geodata/foundation/docker"
 	"testing"
@@ -95,20 +96,25 @@ func Test_City(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to create a duplicate of the city.", tests.Success, testID)
 
-			cities, err = core.QueryAll(ctx)
+			p, err := core.Query(ctx, page.Query{Sort: "name", Limit: 10})
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve all cities: %s.", tests.Failed, testID, err)
 			}
 
-			if len(cities) != 1 {
-				t.Fatalf("\t%s\tTest %d:\tShould get back one city. Got: %v", tests.Failed, testID, len(cities))
+			if len(p.Items) != 1 || p.Total != 1 || p.NextCursor != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back one city on a single page. Got: %v of %v", tests.Failed, testID, len(p.Items), p.Total)
 			}
 
-			if diff := cmp.Diff(saved, cities[0]); diff != "" {
+			if diff := cmp.Diff(saved, p.Items[0]); diff != "" {
 				t.Fatalf("\t%s\tTest %d:\tShould get back the same city. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve all cities.", tests.Success, testID)
 
+			if _, err := core.QueryByCountry(ctx, np.CountryUUID, page.Query{Sort: "uuid", Limit: 10}); !errors.Is(err, city.ErrValidation) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to sort cities by an unknown field: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to sort cities by an unknown field.", tests.Success, testID)
+
 		}
 	}
 }
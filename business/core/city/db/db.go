@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
 	"go.uber.org/zap"
 )
@@ -48,6 +49,26 @@ func (s Store) Create(ctx context.Context, city City) error {
 	return nil
 }
 
+// CreateBatch adds a set of cities to the database with a single multi-row
+// insert. Either all cities are inserted or none of them.
+func (s Store) CreateBatch(ctx context.Context, cities []City) error {
+	if len(cities) == 0 {
+		return nil
+	}
+
+	const q = `
+	INSERT INTO cities
+		(uuid, country_uuid, name, date_created, date_updated)
+	VALUES
+		(:uuid, :country_uuid, :name, :date_created, :date_updated)`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, cities); err != nil {
+		return fmt.Errorf("inserting %d cities: %w", len(cities), err)
+	}
+
+	return nil
+}
+
 // QueryByUUID gets the specified city from the database.
 func (s Store) QueryByUUID(ctx context.Context, cityUUID string) (City, error) {
 	data := struct {
@@ -96,17 +117,100 @@ func (s Store) QueryByCountryUUID(ctx context.Context, countryUUID string) ([]Ci
 	return cities, nil
 }
 
-// QueryAll gets all cities from the database.
-func (s Store) QueryAll(ctx context.Context) ([]City, error) {
+// Query gets a page of cities from the database.
+func (s Store) Query(ctx context.Context, ks page.Keyset) ([]City, error) {
+	return s.query(ctx, "TRUE", map[string]any{}, ks)
+}
+
+// QueryByCountry gets a page of cities of the country from the database.
+func (s Store) QueryByCountry(ctx context.Context, countryUUID string, ks page.Keyset) ([]City, error) {
+	cities, err := s.query(ctx, "country_uuid = :country_uuid", map[string]any{"country_uuid": countryUUID}, ks)
+	if err != nil {
+		return nil, fmt.Errorf("countryUUID[%q]: %w", countryUUID, err)
+	}
+
+	return cities, nil
+}
+
+// query gets a page of the cities matching the filter.
+func (s Store) query(ctx context.Context, filter string, args map[string]any, ks page.Keyset) ([]City, error) {
+	q := fmt.Sprintf(`
+	SELECT
+		*
+	FROM
+		cities
+	WHERE
+		%s AND %s
+	ORDER BY
+		%s
+	LIMIT :limit`, filter, ks.Where("uuid"), ks.OrderBy("uuid"))
+
+	var cities []City
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, ks.Args(args), &cities); err != nil {
+		return nil, fmt.Errorf("selecting cities: %w", err)
+	}
+
+	return cities, nil
+}
+
+// Count returns the number of cities in the database.
+func (s Store) Count(ctx context.Context) (int, error) {
+	return s.count(ctx, "TRUE", map[string]any{})
+}
+
+// CountByCountry returns the number of cities of the country in the database.
+func (s Store) CountByCountry(ctx context.Context, countryUUID string) (int, error) {
+	count, err := s.count(ctx, "country_uuid = :country_uuid", map[string]any{"country_uuid": countryUUID})
+	if err != nil {
+		return 0, fmt.Errorf("countryUUID[%q]: %w", countryUUID, err)
+	}
+
+	return count, nil
+}
+
+// count returns the number of the cities matching the filter.
+func (s Store) count(ctx context.Context, filter string, args map[string]any) (int, error) {
+	q := `
+	SELECT
+		COUNT(*) AS count
+	FROM
+		cities
+	WHERE
+		` + filter
+
+	var result struct {
+		Count int `db:"count"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.getConn(), q, args, &result); err != nil {
+		return 0, fmt.Errorf("counting cities: %w", err)
+	}
+
+	return result.Count, nil
+}
+
+// QueryByUUIDs gets the specified cities from the database.
+func (s Store) QueryByUUIDs(ctx context.Context, cityUUIDs []string) ([]City, error) {
+	if len(cityUUIDs) == 0 {
+		return nil, nil
+	}
+
+	data := struct {
+		UUIDs []string `db:"uuids"`
+	}{
+		UUIDs: cityUUIDs,
+	}
+
 	const q = `
 	SELECT
 		*
 	FROM
-		cities`
+		cities
+	WHERE
+		uuid IN (:uuids)`
 
 	var cities []City
-	if err := database.NamedQuerySlice(ctx, s.getConn(), q, struct{}{}, &cities); err != nil {
-		return []City{}, fmt.Errorf("selecting all cities: %w", err)
+	if err := database.NamedQuerySliceUsingIn(ctx, s.getConn(), q, data, &cities); err != nil {
+		return nil, fmt.Errorf("selecting %d cities: %w", len(cityUUIDs), err)
 	}
 
 	return cities, nil
@@ -33,3 +33,14 @@ func toCitySlice(dbCities []db.City) []City {
 	}
 	return cis
 }
+
+// FromDB converts a city read by the store of another core, like a joined
+// query, to its business form.
+func FromDB(dbCity db.City) City {
+	return toCity(dbCity)
+}
+
+// sortKey returns the cursor key of cities sorted by name.
+func sortKey(c City) (string, string) {
+	return c.Name, c.UUID
+}
@@ -11,11 +11,16 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/mchusovlianov/geodata/business/core/country/db"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"time"
 )
 
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/business/core/country")
+
 // Set of error variables for CRUD operations.
 var (
 	ErrNotFound   = errors.New("country not found")
@@ -23,6 +28,12 @@ var (
 	ErrDuplicate  = errors.New("country already exist")
 )
 
+// sortColumns maps the fields countries are sorted by to their columns.
+var sortColumns = map[string]string{
+	"name": "name",
+	"code": "code",
+}
+
 // Core manages the set of APIs for country access.
 type Core struct {
 	store db.Store
@@ -38,6 +49,9 @@ func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, tx *sqlx.Tx) Core {
 // Create adds a Country to the database. It returns the created Country with
 // fields like ID and DateCreated populated.
 func (c Core) Create(ctx context.Context, country NewCountry, now time.Time) (Country, error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.create")
+	defer span.End()
+
 	validate := validator.New()
 	err := validate.Struct(country)
 	if err != nil {
@@ -65,6 +79,9 @@ func (c Core) Create(ctx context.Context, country NewCountry, now time.Time) (Co
 
 // QueryByUUID gets the specified country from the database.
 func (c Core) QueryByUUID(ctx context.Context, countryUUID string) (Country, error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.querybyuuid")
+	defer span.End()
+
 	dbCountry, err := c.store.QueryByUUID(ctx, countryUUID)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -78,6 +95,9 @@ func (c Core) QueryByUUID(ctx context.Context, countryUUID string) (Country, err
 
 // QueryByCode gets the specified country from the database by country code.
 func (c Core) QueryByCode(ctx context.Context, code string) (Country, error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.querybycode")
+	defer span.End()
+
 	dbCountry, err := c.store.QueryByCode(ctx, code)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -89,15 +109,54 @@ func (c Core) QueryByCode(ctx context.Context, code string) (Country, error) {
 	return toCountry(dbCountry), nil
 }
 
-// QueryAll gets all countries from the database.
-func (c Core) QueryAll(ctx context.Context) ([]Country, error) {
-	dbCountries, err := c.store.QueryAll(ctx)
+// QueryByUUIDs gets the specified countries. Unknown identifiers are skipped.
+func (c Core) QueryByUUIDs(ctx context.Context, countryUUIDs []string) ([]Country, error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.querybyuuids")
+	defer span.End()
+
+	dbCountries, err := c.store.QueryByUUIDs(ctx, countryUUIDs)
 	if err != nil {
-		if errors.Is(err, database.ErrDBNotFound) {
-			return []Country{}, ErrNotFound
-		}
-		return []Country{}, fmt.Errorf("query: %w", err)
+		return nil, fmt.Errorf("query: %w", err)
 	}
 
 	return toCountrySlice(dbCountries), nil
 }
+
+// Query gets a page of countries sorted by name or code.
+func (c Core) Query(ctx context.Context, q page.Query) (page.Page[Country], error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.query")
+	defer span.End()
+
+	return c.query(ctx, q, true)
+}
+
+// QueryPage gets a page of countries like Query does without counting them, the
+// total of the page is zero. It is meant to read all countries page by page.
+func (c Core) QueryPage(ctx context.Context, q page.Query) (page.Page[Country], error) {
+	ctx, span := tracer.Start(ctx, "business.core.country.querypage")
+	defer span.End()
+
+	return c.query(ctx, q, false)
+}
+
+// query gets a page of countries, the total is counted only if asked for.
+func (c Core) query(ctx context.Context, q page.Query, count bool) (page.Page[Country], error) {
+	ks, err := q.Keyset(sortColumns)
+	if err != nil {
+		return page.Page[Country]{}, fmt.Errorf("%w: %s", ErrValidation, err)
+	}
+
+	dbCountries, err := c.store.Query(ctx, ks)
+	if err != nil {
+		return page.Page[Country]{}, fmt.Errorf("query: %w", err)
+	}
+
+	var total int
+	if count {
+		if total, err = c.store.Count(ctx); err != nil {
+			return page.Page[Country]{}, fmt.Errorf("count: %w", err)
+		}
+	}
+
+	return page.New(toCountrySlice(dbCountries), total, ks, sortKey(ks.Column)), nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/business/data/tests"
 	"github.com/mchusovlianov/geodata/foundation/docker"
 	"testing"
@@ -97,20 +98,55 @@ func Test_Country(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to create a duplicate of the country.", tests.Success, testID)
 
-			countries, err := core.QueryAll(ctx)
+			p, err := core.Query(ctx, page.Query{Sort: "name", Limit: 10})
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve all countries: %s.", tests.Failed, testID, err)
 			}
 
-			if len(countries) != 1 {
-				t.Fatalf("\t%s\tTest %d:\tShould get back one country. Got: %v", tests.Failed, testID, len(countries))
+			if len(p.Items) != 1 || p.Total != 1 || p.NextCursor != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back one country on a single page. Got: %v of %v", tests.Failed, testID, len(p.Items), p.Total)
 			}
 
-			if diff := cmp.Diff(saved, countries[0]); diff != "" {
+			if diff := cmp.Diff(saved, p.Items[0]); diff != "" {
 				t.Fatalf("\t%s\tTest %d:\tShould get back the same country. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve all countries.", tests.Success, testID)
 
+			other, err := core.Create(ctx, country.NewCountry{Code: "AD", Name: "Andorra"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create another country : %s.", tests.Failed, testID, err)
+			}
+
+			q := page.Query{Sort: "-code", Limit: 1}
+			var codes []string
+			for {
+				p, err := core.Query(ctx, q)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to page through countries: %s.", tests.Failed, testID, err)
+				}
+				if p.Total != 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould count two countries. Got: %v", tests.Failed, testID, p.Total)
+				}
+				for _, c := range p.Items {
+					codes = append(codes, c.Code)
+				}
+
+				if p.NextCursor == "" {
+					break
+				}
+				q.Cursor = p.NextCursor
+			}
+
+			if diff := cmp.Diff([]string{saved.Code, other.Code}, codes); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould page through countries by descending code. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould page through countries by descending code.", tests.Success, testID)
+
+			if _, err := core.Query(ctx, page.Query{Sort: "name", Cursor: "!", Limit: 1}); !errors.Is(err, country.ErrValidation) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to query a page with a malformed cursor: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to query a page with a malformed cursor.", tests.Success, testID)
+
 		}
 	}
 }
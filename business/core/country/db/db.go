@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
 	"go.uber.org/zap"
 )
@@ -96,17 +97,68 @@ func (s Store) QueryByCode(ctx context.Context, code string) (Country, error) {
 	return country, nil
 }
 
-// QueryAll gets all countries from the database.
-func (s Store) QueryAll(ctx context.Context) ([]Country, error) {
-	const q = `
+// Query gets a page of countries from the database.
+func (s Store) Query(ctx context.Context, ks page.Keyset) ([]Country, error) {
+	q := fmt.Sprintf(`
 	SELECT
 		*
+	FROM
+		countries
+	WHERE
+		%s
+	ORDER BY
+		%s
+	LIMIT :limit`, ks.Where("uuid"), ks.OrderBy("uuid"))
+
+	var countries []Country
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, ks.Args(map[string]any{}), &countries); err != nil {
+		return nil, fmt.Errorf("selecting countries: %w", err)
+	}
+
+	return countries, nil
+}
+
+// Count returns the number of countries in the database.
+func (s Store) Count(ctx context.Context) (int, error) {
+	const q = `
+	SELECT
+		COUNT(*) AS count
 	FROM
 		countries`
 
+	var result struct {
+		Count int `db:"count"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.getConn(), q, struct{}{}, &result); err != nil {
+		return 0, fmt.Errorf("counting countries: %w", err)
+	}
+
+	return result.Count, nil
+}
+
+// QueryByUUIDs gets the specified countries from the database.
+func (s Store) QueryByUUIDs(ctx context.Context, countryUUIDs []string) ([]Country, error) {
+	if len(countryUUIDs) == 0 {
+		return nil, nil
+	}
+
+	data := struct {
+		UUIDs []string `db:"uuids"`
+	}{
+		UUIDs: countryUUIDs,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		countries
+	WHERE
+		uuid IN (:uuids)`
+
 	var countries []Country
-	if err := database.NamedQuerySlice(ctx, s.getConn(), q, struct{}{}, &countries); err != nil {
-		return []Country{}, fmt.Errorf("selecting all countries: %w", err)
+	if err := database.NamedQuerySliceUsingIn(ctx, s.getConn(), q, data, &countries); err != nil {
+		return nil, fmt.Errorf("selecting %d countries: %w", len(countryUUIDs), err)
 	}
 
 	return countries, nil
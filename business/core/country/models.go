@@ -33,3 +33,19 @@ func toCountrySlice(dbCities []db.Country) []Country {
 	}
 	return cis
 }
+
+// FromDB converts a country read by the store of another core, like a joined
+// query, to its business form.
+func FromDB(dbCountry db.Country) Country {
+	return toCountry(dbCountry)
+}
+
+// sortKey returns the cursor key of countries sorted by the column.
+func sortKey(column string) func(Country) (string, string) {
+	return func(c Country) (string, string) {
+		if column == "code" {
+			return c.Code, c.UUID
+		}
+		return c.Name, c.UUID
+	}
+}
@@ -0,0 +1,242 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/foundation/lru"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// CacheStats tells how well the cache serves the lookups.
+type CacheStats struct {
+	Hits   int64 // Lookups answered by the cache.
+	Misses int64 // Lookups passed to the wrapped querier.
+	Size   int   // Number of cached lookups.
+}
+
+// cached is the result of a lookup, the error is nil or ErrNotFound.
+type cached struct {
+	geo Geo
+	err error
+}
+
+// Cache keeps the results of recent lookups by ip in front of another querier,
+// including the ones which found nothing. Lookups of the same address in other
+// text forms share an entry.
+type Cache struct {
+	log        *zap.SugaredLogger
+	db         *sqlx.DB
+	querier    Querier
+	lookups    *lru.Cache[string, cached]
+	hits       atomic.Int64
+	misses     atomic.Int64
+	generation atomic.Int64
+
+	// purges counts the purges, lookups started before a purge aren't cached.
+	mu     sync.RWMutex
+	purges int64
+}
+
+// NewCache constructs a cache of up to size lookups in front of the querier, a
+// lookup is kept for ttl at most.
+func NewCache(log *zap.SugaredLogger, db *sqlx.DB, querier Querier, size int, ttl time.Duration) *Cache {
+	return &Cache{
+		log:     log,
+		db:      db,
+		querier: querier,
+		lookups: lru.New[string, cached](size, ttl),
+	}
+}
+
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address with its city and country from the cache or the wrapped querier.
+func (c *Cache) QueryByIP(ctx context.Context, ip string) (Geo, error) {
+	ctx, span := tracer.Start(ctx, "business.core.geo.cache.querybyip")
+	defer span.End()
+
+	addr, err := location.ParseIP(ip)
+	if err != nil {
+		return Geo{}, ErrValidation
+	}
+	key := addr.String()
+
+	res, ok := c.lookups.Get(key)
+	span.SetAttributes(attribute.Bool("cache.hit", ok))
+	if ok {
+		c.hits.Inc()
+		return res.geo, res.err
+	}
+	c.misses.Inc()
+
+	purges := c.purgeCount()
+	g, err := c.querier.QueryByIP(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Geo{}, err
+	}
+
+	c.add(purges, key, cached{geo: g, err: err})
+	return g, err
+}
+
+// QueryByIPs gets the location with the most specific ip range containing each
+// of the ip-addresses with its city and country, in the order of the addresses.
+// The addresses missing in the cache are passed to the wrapped querier at once.
+func (c *Cache) QueryByIPs(ctx context.Context, ips []string) ([]IPLookup, error) {
+	ctx, span := tracer.Start(ctx, "business.core.geo.cache.querybyips")
+	defer span.End()
+
+	lookups := make([]IPLookup, len(ips))
+
+	// the addresses to ask for and the lookups waiting for each of them
+	var misses []string
+	waiting := make(map[string][]int)
+	for i, ip := range ips {
+		lookups[i].IP = ip
+
+		addr, err := location.ParseIP(ip)
+		if err != nil {
+			lookups[i].Err = ErrValidation
+			continue
+		}
+		key := addr.String()
+
+		if res, ok := c.lookups.Get(key); ok {
+			c.hits.Inc()
+			lookups[i].Geo, lookups[i].Err = res.geo, res.err
+			continue
+		}
+
+		if _, ok := waiting[key]; !ok {
+			c.misses.Inc()
+			misses = append(misses, key)
+		}
+		waiting[key] = append(waiting[key], i)
+	}
+	span.SetAttributes(attribute.Int("cache.misses", len(misses)))
+
+	if len(misses) == 0 {
+		return lookups, nil
+	}
+
+	purges := c.purgeCount()
+	found, err := c.querier.QueryByIPs(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range found {
+		for _, i := range waiting[res.IP] {
+			lookups[i].Geo, lookups[i].Err = res.Geo, res.Err
+		}
+
+		if res.Err == nil || errors.Is(res.Err, ErrNotFound) {
+			c.add(purges, res.IP, cached{geo: res.Geo, err: res.Err})
+		}
+	}
+
+	return lookups, nil
+}
+
+// QueryNearby gets up to limit locations with their cities and countries within
+// the radius in kilometres of the position from the wrapped querier, searches
+// aren't cached.
+func (c *Cache) QueryNearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]NearbyGeo, error) {
+	return c.querier.QueryNearby(ctx, lat, lon, radiusKm, limit)
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   c.lookups.Len(),
+	}
+}
+
+// Purge drops all cached lookups. The results of lookups still running are
+// dropped too, they may come from the old dataset.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purges++
+	c.lookups.Purge()
+}
+
+// purgeCount returns the number of purges so far, it is taken before a lookup.
+func (c *Cache) purgeCount() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.purges
+}
+
+// add caches the result of a lookup unless the cache was purged since the
+// lookup started.
+func (c *Cache) add(purges int64, key string, res cached) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.purges == purges {
+		c.lookups.Add(key, res)
+	}
+}
+
+// reloader is implemented by queriers holding a copy of the dataset like Index.
+type reloader interface {
+	Reload(ctx context.Context) (bool, error)
+}
+
+// Watch purges the cache every interval in which an import or a rollback made
+// another generation of the dataset live, until the context is cancelled. A
+// wrapped querier holding a copy of the dataset is reloaded first, so the cache
+// isn't filled with the old records again.
+func (c *Cache) Watch(ctx context.Context, interval time.Duration) {
+	if gen, err := currentGeneration(ctx, c.db); err == nil {
+		c.generation.Store(gen)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := c.changed(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					c.log.Errorw("cache watch", "ERROR", err)
+				}
+				continue
+			}
+
+			if changed {
+				stats := c.Stats()
+				c.Purge()
+				c.log.Infow("cache purged", "hits", stats.Hits, "misses", stats.Misses, "size", stats.Size)
+			}
+		}
+	}
+}
+
+// changed reports whether another generation became live since the last check.
+func (c *Cache) changed(ctx context.Context) (bool, error) {
+	if r, ok := c.querier.(reloader); ok {
+		return r.Reload(ctx)
+	}
+
+	gen, err := currentGeneration(ctx, c.db)
+	if err != nil {
+		return false, err
+	}
+
+	return c.generation.Swap(gen) != gen, nil
+}
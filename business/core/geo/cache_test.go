@@ -0,0 +1,172 @@
+package geo
+
+import (
+	"context"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// countingQuerier knows a single ip and counts the lookups. The lookups call
+// during while they run if it is set.
+type countingQuerier struct {
+	ip       string
+	lookups  int
+	reloaded bool
+	during   func()
+}
+
+func (q *countingQuerier) QueryByIP(ctx context.Context, ip string) (Geo, error) {
+	q.lookups++
+	if q.during != nil {
+		q.during()
+	}
+	if ip != q.ip {
+		return Geo{}, ErrNotFound
+	}
+
+	return Geo{Location: location.Location{IP: ip}}, nil
+}
+
+func (q *countingQuerier) QueryByIPs(ctx context.Context, ips []string) ([]IPLookup, error) {
+	lookups := make([]IPLookup, len(ips))
+	for i, ip := range ips {
+		lookups[i].IP = ip
+		lookups[i].Geo, lookups[i].Err = q.QueryByIP(ctx, ip)
+	}
+
+	return lookups, nil
+}
+
+func (q *countingQuerier) QueryNearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]NearbyGeo, error) {
+	return nil, nil
+}
+
+func (q *countingQuerier) Reload(ctx context.Context) (bool, error) {
+	return q.reloaded, nil
+}
+
+func Test_Cache(t *testing.T) {
+	ctx := context.Background()
+	log := zap.NewNop().Sugar()
+
+	t.Log("Given the need to cache lookups by ip.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen looking up the same ips again.", testID)
+		{
+			q := countingQuerier{ip: "10.0.0.1"}
+			c := NewCache(log, nil, &q, 2, time.Minute)
+
+			for _, ip := range []string{"10.0.0.1", "::ffff:10.0.0.1", "10.0.0.1"} {
+				g, err := c.QueryByIP(ctx, ip)
+				if err != nil || g.Location.IP != "10.0.0.1" {
+					t.Fatalf("\t%s\tTest %d:\tShould find the location of %s: %v.", tests.Failed, testID, ip, err)
+				}
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := c.QueryByIP(ctx, "10.0.0.2"); err != ErrNotFound {
+					t.Fatalf("\t%s\tTest %d:\tShould not find an unknown ip: %v.", tests.Failed, testID, err)
+				}
+			}
+
+			if _, err := c.QueryByIP(ctx, "12345"); err != ErrValidation {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a malformed ip: %v.", tests.Failed, testID, err)
+			}
+
+			if q.lookups != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould ask the querier once per address. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+
+			if stats := c.Stats(); stats.Hits != 3 || stats.Misses != 2 || stats.Size != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould count 3 hits, 2 misses and 2 entries. Got %+v.", tests.Failed, testID, stats)
+			}
+			t.Logf("\t%s\tTest %d:\tShould answer known and unknown ips from the cache.", tests.Success, testID)
+
+			// 10.0.0.1 was used before 10.0.0.2, so it's evicted by 10.0.0.3
+			c.QueryByIP(ctx, "10.0.0.3")
+			c.QueryByIP(ctx, "10.0.0.2")
+			c.QueryByIP(ctx, "10.0.0.1")
+			if q.lookups != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould evict the least recently used ip. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould evict the least recently used ip.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen looking up many ips at once.", testID)
+		{
+			q := countingQuerier{ip: "10.0.0.1"}
+			c := NewCache(log, nil, &q, 10, time.Minute)
+			c.QueryByIP(ctx, "10.0.0.2")
+
+			ips := []string{"10.0.0.1", "12345", "10.0.0.2", "::ffff:10.0.0.1", "10.0.0.3"}
+			lookups, err := c.QueryByIPs(ctx, ips)
+			if err != nil || len(lookups) != len(ips) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up many ips: %v, %d lookups.", tests.Failed, testID, err, len(lookups))
+			}
+
+			for i, exp := range []error{nil, ErrValidation, ErrNotFound, nil, ErrNotFound} {
+				if lookups[i].IP != ips[i] || lookups[i].Err != exp || (exp == nil && lookups[i].Geo.Location.IP != "10.0.0.1") {
+					t.Fatalf("\t%s\tTest %d:\tShould get the lookup of %s. Got %+v.", tests.Failed, testID, ips[i], lookups[i])
+				}
+			}
+			if q.lookups != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould ask the querier once per address missing in the cache. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould ask the querier only for the addresses missing in the cache.", tests.Success, testID)
+
+			c.QueryByIPs(ctx, ips)
+			if q.lookups != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould cache the lookups of many ips. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould cache the lookups of many ips.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen the cached lookups are outdated.", testID)
+		{
+			q := countingQuerier{ip: "10.0.0.1"}
+			c := NewCache(log, nil, &q, 10, 10*time.Millisecond)
+
+			c.QueryByIP(ctx, "10.0.0.1")
+			time.Sleep(20 * time.Millisecond)
+			c.QueryByIP(ctx, "10.0.0.1")
+			if q.lookups != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould expire a lookup after the ttl. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould expire a lookup after the ttl.", tests.Success, testID)
+
+			q.reloaded = true
+			changed, err := c.changed(ctx)
+			if err != nil || !changed {
+				t.Fatalf("\t%s\tTest %d:\tShould see a reload of the wrapped querier: %v, %v.", tests.Failed, testID, changed, err)
+			}
+
+			c.Purge()
+			c.QueryByIP(ctx, "10.0.0.1")
+			if q.lookups != 3 || c.Stats().Size != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget the lookups when purged. Asked %d times.", tests.Failed, testID, q.lookups)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget the lookups when purged.", tests.Success, testID)
+
+			// a purge while the lookups run means they may have read the old dataset
+			q.during = c.Purge
+			c.QueryByIP(ctx, "10.0.0.2")
+			c.QueryByIPs(ctx, []string{"10.0.0.3"})
+			if size := c.Stats().Size; size != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not cache lookups started before a purge. Got %d entries.", tests.Failed, testID, size)
+			}
+
+			q.during = nil
+			c.QueryByIP(ctx, "10.0.0.2")
+			if size := c.Stats().Size; size != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould cache lookups started after a purge. Got %d entries.", tests.Failed, testID, size)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not cache lookups started before a purge.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	locationdb "github.com/mchusovlianov/geodata/business/core/location/db"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// geoColumns selects the columns of the location l, the city ci and the country
+// co named after the fields of Geo so they are scanned into the nested structs.
+const geoColumns = `
+		l.uuid AS "location.uuid",
+		l.city_uuid AS "location.city_uuid",
+		l.ip_from AS "location.ip_from",
+		l.ip_to AS "location.ip_to",
+		l.ip_span AS "location.ip_span",
+		l.latitude AS "location.latitude",
+		l.longitude AS "location.longitude",
+		l.geohash AS "location.geohash",
+		l.mystery_value AS "location.mystery_value",
+		l.date_created AS "location.date_created",
+		l.date_updated AS "location.date_updated",
+		ci.uuid AS "city.uuid",
+		ci.country_uuid AS "city.country_uuid",
+		ci.name AS "city.name",
+		ci.date_created AS "city.date_created",
+		ci.date_updated AS "city.date_updated",
+		co.uuid AS "country.uuid",
+		co.name AS "country.name",
+		co.code AS "country.code",
+		co.date_created AS "country.date_created",
+		co.date_updated AS "country.date_updated"`
+
+// earthRadiusM is the mean radius of the earth in metres used for distances.
+const earthRadiusM = "6371008.8"
+
+type Store struct {
+	log       *zap.SugaredLogger
+	db        *sqlx.DB
+	tx        *sqlx.Tx
+	locations locationdb.Store // keeps the spans of the ip ranges.
+}
+
+// NewStore constructs a data for api access.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB, tx *sqlx.Tx) Store {
+	return Store{
+		log:       log,
+		db:        db,
+		tx:        tx,
+		locations: locationdb.NewStore(log, db, tx),
+	}
+}
+
+// getConn returns a required execution context: transaction or database connection
+func (s Store) getConn() sqlx.ExtContext {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return s.db
+}
+
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address given as 16 bytes together with its city and country. The range is
+// picked before the join, so a location without a city isn't replaced by a
+// wider one. Only the blocks of the index which may hold a range containing the
+// address are read, see locationdb.SpanWhere and locationdb.WithSpans.
+func (s Store) QueryByIP(ctx context.Context, ip []byte) (Geo, error) {
+	data := struct {
+		IP []byte `db:"ip"`
+	}{
+		IP: ip,
+	}
+
+	var geo Geo
+	err := s.locations.WithSpans(ctx, func(gen int64, spans []int) error {
+		if len(spans) == 0 {
+			return database.ErrDBNotFound
+		}
+
+		q := `
+		SELECT` + geoColumns + `
+		FROM
+			(SELECT
+				*
+			FROM
+				locations
+			WHERE
+				ip_from <= :ip AND ip_to >= :ip AND ` + locationdb.SpanWhere("", spans, ip) + ` AND ` + locationdb.GenerationWhere(gen) + `
+			ORDER BY
+				ip_from DESC, ip_to ASC
+			LIMIT 1) l
+		JOIN
+			cities ci ON ci.uuid = l.city_uuid
+		JOIN
+			countries co ON co.uuid = ci.country_uuid`
+
+		return database.NamedQueryStruct(ctx, s.getConn(), q, data, &geo)
+	})
+	if err != nil {
+		return Geo{}, fmt.Errorf("selecting locationIP[%x]: %w", ip, err)
+	}
+
+	return geo, nil
+}
+
+// QueryByIPs gets for each ip-address given as 16 bytes the location with the
+// most specific ip range containing it together with its city and country. Every
+// address picks its range by its own ordered subquery, the subqueries are glued
+// with UNION ALL and joined once, so all of them are resolved in one round trip.
+// Addresses without a location are skipped.
+func (s Store) QueryByIPs(ctx context.Context, ips [][]byte) ([]IPGeo, error) {
+	if len(ips) == 0 {
+		return nil, nil
+	}
+
+	const sub = `
+			(SELECT
+				? AS idx, locations.*
+			FROM
+				locations
+			WHERE
+				ip_from <= ? AND ip_to >= ? AND %s AND %s
+			ORDER BY
+				ip_from DESC, ip_to ASC
+			LIMIT 1)`
+
+	// a missing address tells the spans may be of another generation
+	var geos []IPGeo
+	err := s.locations.WithSpans(ctx, func(gen int64, spans []int) error {
+		geos = nil
+		if len(spans) == 0 {
+			return database.ErrDBNotFound
+		}
+
+		var subs strings.Builder
+		args := make([]any, 0, 3*len(ips))
+		for i, ip := range ips {
+			if i > 0 {
+				subs.WriteString("\n\t\t\tUNION ALL")
+			}
+			fmt.Fprintf(&subs, sub, locationdb.SpanWhere("", spans, ip), locationdb.GenerationWhere(gen))
+			args = append(args, i, ip, ip)
+		}
+
+		q := `
+		SELECT
+			l.idx,` + geoColumns + `
+		FROM (` + subs.String() + `
+		) l
+		JOIN
+			cities ci ON ci.uuid = l.city_uuid
+		JOIN
+			countries co ON co.uuid = ci.country_uuid`
+
+		if err := database.QuerySlice(ctx, s.getConn(), q, args, &geos); err != nil {
+			return err
+		}
+		if len(geos) < len(ips) {
+			return database.ErrDBNotFound
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, database.ErrDBNotFound) {
+		return nil, fmt.Errorf("selecting locations of %d ips: %w", len(ips), err)
+	}
+
+	return geos, nil
+}
+
+// QueryNearby gets up to limit locations with their cities and countries within
+// the radius of the position ordered by the distance. Only the locations in the
+// geohash cells are looked at; without cells the locations between the minimal
+// and the maximal latitude are.
+func (s Store) QueryNearby(ctx context.Context, nearby Nearby) ([]NearbyGeo, error) {
+	data := map[string]any{
+		"lat":       nearby.Latitude,
+		"lon":       nearby.Longitude,
+		"radius_km": nearby.RadiusKm,
+		"min_lat":   nearby.MinLatitude,
+		"max_lat":   nearby.MaxLatitude,
+		"limit":     nearby.Limit,
+	}
+
+	where := "l.latitude BETWEEN :min_lat AND :max_lat"
+	if len(nearby.Cells) > 0 {
+		conds := make([]string, len(nearby.Cells))
+		for i, cell := range nearby.Cells {
+			key := fmt.Sprintf("cell%d", i)
+			conds[i] = "l.geohash LIKE :" + key
+			data[key] = cell + "%"
+		}
+		where = strings.Join(conds, " OR ")
+	}
+
+	q := `
+	SELECT` + geoColumns + `,
+		ST_Distance_Sphere(POINT(l.longitude, l.latitude), POINT(:lon, :lat), ` + earthRadiusM + `) / 1000 AS distance_km
+	FROM
+		locations l
+	JOIN
+		cities ci ON ci.uuid = l.city_uuid
+	JOIN
+		countries co ON co.uuid = ci.country_uuid
+	WHERE
+		` + where + `
+	HAVING
+		distance_km <= :radius_km
+	ORDER BY
+		distance_km, l.uuid
+	LIMIT :limit`
+
+	var geos []NearbyGeo
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, data, &geos); err != nil {
+		return nil, fmt.Errorf("selecting locations near [%f, %f]: %w", nearby.Latitude, nearby.Longitude, err)
+	}
+
+	return geos, nil
+}
@@ -0,0 +1,39 @@
+// Package db is a package for keeping all db-related logic
+package db
+
+import (
+	citydb "github.com/mchusovlianov/geodata/business/core/city/db"
+	countrydb "github.com/mchusovlianov/geodata/business/core/country/db"
+	locationdb "github.com/mchusovlianov/geodata/business/core/location/db"
+)
+
+// Geo is a location joined with its city and country.
+type Geo struct {
+	Location locationdb.Location `db:"location"` // Location of the ip-address.
+	City     citydb.City         `db:"city"`     // City of the location.
+	Country  countrydb.Country   `db:"country"`  // Country of the city.
+}
+
+// IPGeo is the location with its city and country found for the ip-address at
+// the index of a bulk lookup.
+type IPGeo struct {
+	Index int `db:"idx"` // Index of the ip-address in the lookup.
+	Geo
+}
+
+// Nearby is a search of locations around a position.
+type Nearby struct {
+	Latitude    float64  // Latitude of the position.
+	Longitude   float64  // Longitude of the position.
+	RadiusKm    float64  // Largest distance of the locations.
+	Cells       []string // Geohashes of the cells covering the circle.
+	MinLatitude float64  // Smallest latitude of the circle, used without cells.
+	MaxLatitude float64  // Largest latitude of the circle, used without cells.
+	Limit       int      // Largest number of the locations.
+}
+
+// NearbyGeo is a location with its city and country found near a position.
+type NearbyGeo struct {
+	Geo
+	DistanceKm float64 `db:"distance_km"` // Distance from the position.
+}
@@ -0,0 +1,199 @@
+// Package geo provides a core business API for reading locations together with
+// their cities and countries. It reads them by joined queries instead of asking
+// the location, city and country cores one after another.
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/core/geo/db"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"github.com/mchusovlianov/geodata/foundation/geohash"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+	"math"
+)
+
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/business/core/geo")
+
+// lookupChunkSize limits the number of ip-addresses resolved by one query.
+const lookupChunkSize = 500
+
+// Limits of nearby searches.
+const (
+	MaxNearbyRadiusKm = 1000
+	MaxNearbyLimit    = 100
+)
+
+// Set of error variables for read operations.
+var (
+	ErrNotFound   = errors.New("location not found")
+	ErrValidation = errors.New("validation failed")
+)
+
+// Core manages the set of APIs for reading locations with cities and countries.
+type Core struct {
+	store db.Store
+}
+
+// NewCore constructs a core for geo api access.
+func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, tx *sqlx.Tx) Core {
+	return Core{
+		store: db.NewStore(log, dbConn, tx),
+	}
+}
+
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address with its city and country in one query.
+func (c Core) QueryByIP(ctx context.Context, ip string) (Geo, error) {
+	ctx, span := tracer.Start(ctx, "business.core.geo.querybyip")
+	defer span.End()
+
+	addr, err := location.ParseIP(ip)
+	if err != nil {
+		return Geo{}, ErrValidation
+	}
+
+	dbGeo, err := c.store.QueryByIP(ctx, location.IPKey(addr))
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Geo{}, ErrNotFound
+		}
+		return Geo{}, fmt.Errorf("query: %w", err)
+	}
+
+	return toGeo(dbGeo), nil
+}
+
+// QueryByIPs gets the location with the most specific ip range containing each
+// of the ip-addresses with its city and country. The lookups are returned in the
+// order of the addresses, the ones of invalid or unknown addresses carry
+// ErrValidation or ErrNotFound.
+func (c Core) QueryByIPs(ctx context.Context, ips []string) ([]IPLookup, error) {
+	ctx, span := tracer.Start(ctx, "business.core.geo.querybyips")
+	defer span.End()
+
+	lookups := make([]IPLookup, len(ips))
+
+	// the same address asked several times is resolved once
+	var keys [][]byte
+	index := make(map[string]int, len(ips))
+	keyOf := make([]int, len(ips))
+	for i, ip := range ips {
+		lookups[i] = IPLookup{IP: ip, Err: ErrNotFound}
+
+		addr, err := location.ParseIP(ip)
+		if err != nil {
+			lookups[i].Err = ErrValidation
+			keyOf[i] = -1
+			continue
+		}
+
+		key := location.IPKey(addr)
+		k, ok := index[string(key)]
+		if !ok {
+			k = len(keys)
+			index[string(key)] = k
+			keys = append(keys, key)
+		}
+		keyOf[i] = k
+	}
+
+	found := make([]*Geo, len(keys))
+	for start := 0; start < len(keys); start += lookupChunkSize {
+		end := start + lookupChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		dbGeos, err := c.store.QueryByIPs(ctx, keys[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+
+		for _, dbGeo := range dbGeos {
+			geo := toGeo(dbGeo.Geo)
+			found[start+dbGeo.Index] = &geo
+		}
+	}
+
+	for i, k := range keyOf {
+		if k < 0 {
+			continue
+		}
+
+		if geo := found[k]; geo != nil {
+			lookups[i].Geo = *geo
+			lookups[i].Err = nil
+		}
+	}
+
+	return lookups, nil
+}
+
+// QueryNearby gets up to limit locations with their cities and countries within
+// the radius in kilometres of the position, the closest first. The search looks
+// at the locations of the smallest geohash cell holding the position, which is
+// large enough for the cells around it to cover the circle, and of those cells.
+func (c Core) QueryNearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]NearbyGeo, error) {
+	ctx, span := tracer.Start(ctx, "business.core.geo.querynearby")
+	defer span.End()
+
+	switch {
+	case lat < -90 || lat > 90 || lon < -180 || lon > 180:
+		return nil, ErrValidation
+	case radiusKm <= 0 || radiusKm > MaxNearbyRadiusKm:
+		return nil, ErrValidation
+	case limit < 1 || limit > MaxNearbyLimit:
+		return nil, ErrValidation
+	}
+
+	// angular radius of the circle in degrees
+	dLat := radiusKm / geohash.EarthRadiusKm * 180 / math.Pi
+
+	dbGeos, err := c.store.QueryNearby(ctx, db.Nearby{
+		Latitude:    lat,
+		Longitude:   lon,
+		RadiusKm:    radiusKm,
+		Cells:       coverCells(lat, lon, dLat),
+		MinLatitude: math.Max(-90, lat-dLat),
+		MaxLatitude: math.Min(90, lat+dLat),
+		Limit:       limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return toNearbyGeoSlice(dbGeos), nil
+}
+
+// coverCells returns the geohashes of the cells which cover the circle of the
+// angular radius in degrees around the position: the cell of the position and
+// the ones around it. A circle reaching a pole or wider than the largest cells
+// isn't covered, nil is returned then.
+func coverCells(lat, lon, dLat float64) []string {
+	if lat+dLat >= 90 || lat-dLat <= -90 {
+		return nil
+	}
+
+	// the widest longitude span of a circle on a sphere
+	sin := math.Sin(dLat*math.Pi/180) / math.Cos(lat*math.Pi/180)
+	if sin >= 1 {
+		return nil
+	}
+	dLon := math.Asin(sin) * 180 / math.Pi
+
+	for precision := geohash.MaxPrecision; precision > 0; precision-- {
+		height, width := geohash.CellSize(precision)
+		if height >= dLat && width >= dLon {
+			cell := geohash.Encode(lat, lon, precision)
+			return append([]string{cell}, geohash.Neighbours(cell)...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package geo_test
+
+import (
+	"context"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/geo"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"testing"
+	"time"
+)
+
+func Test_Geo(t *testing.T) {
+	test := tests.NewIntegration(
+		t,
+		tests.DBContainer{
+			Image: "percona",
+			Port:  "3306",
+			Name:  "testgeo",
+			Args:  []string{"-e", "MYSQL_ROOT_PASSWORD=root"},
+		},
+	)
+	t.Cleanup(test.Teardown)
+
+	core := geo.NewCore(test.Log, test.DB, nil)
+
+	t.Log("Given the need to read locations with their cities and countries.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen looking up an ip.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+			cntr, err := country.NewCore(test.Log, test.DB, nil).Create(ctx, country.NewCountry{Name: "Netherlands", Code: "NL"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a country : %s.", tests.Failed, testID, err)
+			}
+
+			cty, err := city.NewCore(test.Log, test.DB, nil).Create(ctx, city.NewCity{Name: "Amsterdam", CountryUUID: cntr.UUID}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a city : %s.", tests.Failed, testID, err)
+			}
+
+			locCore := location.NewCore(test.Log, test.DB, nil)
+			loc, err := locCore.Create(ctx, location.NewLocation{
+				IP:           "10.0.0.0/8",
+				Longitude:    7.206435933364332,
+				Latitude:     -84.87503094689836,
+				MysteryValue: 7823011346,
+				CityUUID:     cty.UUID,
+			}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a location : %s.", tests.Failed, testID, err)
+			}
+
+			// a more specific range of an unknown city
+			_, err = locCore.Create(ctx, location.NewLocation{
+				IP:           "10.1.0.0/16",
+				Longitude:    7.206435933364332,
+				Latitude:     -84.87503094689836,
+				MysteryValue: 7823011346,
+				CityUUID:     "6c1a1d32-456f-4a20-91d0-cf962c3d6d67",
+			}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a location : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a country, a city and locations.", tests.Success, testID)
+
+			got, err := core.QueryByIP(ctx, "10.2.0.1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve location by IP: %s.", tests.Failed, testID, err)
+			}
+
+			exp := geo.Geo{Location: loc, Country: cntr, City: cty}
+			if diff := cmp.Diff(exp, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the location with its city and country. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the location with its city and country.", tests.Success, testID)
+
+			if _, err := core.QueryByIP(ctx, "10.1.0.1"); err != geo.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find the most specific location without a city: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find the most specific location without a city.", tests.Success, testID)
+
+			if _, err := core.QueryByIP(ctx, "11.0.0.1"); err != geo.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find an ip outside of all ranges: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find an ip outside of all ranges.", tests.Success, testID)
+
+			if _, err := core.QueryByIP(ctx, "12345"); err != geo.ErrValidation {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a malformed ip: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept a malformed ip.", tests.Success, testID)
+
+			ips := []string{"10.2.0.1", "10.1.0.1", "12345", "::ffff:10.2.0.1", "11.0.0.1"}
+			lookups, err := core.QueryByIPs(ctx, ips)
+			if err != nil || len(lookups) != len(ips) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up many ips: %v, %d lookups.", tests.Failed, testID, err, len(lookups))
+			}
+			for i, ip := range ips {
+				exp, expErr := core.QueryByIP(ctx, ip)
+				if lookups[i].IP != ip || lookups[i].Err != expErr {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same error for %s as a single lookup: %v, expected %v.", tests.Failed, testID, ip, lookups[i].Err, expErr)
+				}
+				if diff := cmp.Diff(exp, lookups[i].Geo); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same location for %s as a single lookup. Diff:\n%s", tests.Failed, testID, ip, diff)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same results for many ips as for single ones.", tests.Success, testID)
+
+			nearby, err := core.QueryNearby(ctx, -84.8, 7.3, 50, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to search nearby locations: %s.", tests.Failed, testID, err)
+			}
+
+			if len(nearby) != 1 || nearby[0].Location.UUID != loc.UUID || nearby[0].City.UUID != cty.UUID || nearby[0].DistanceKm <= 0 || nearby[0].DistanceKm > 50 {
+				t.Fatalf("\t%s\tTest %d:\tShould find the location with a city nearby. Got %+v.", tests.Failed, testID, nearby)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the location with a city nearby.", tests.Success, testID)
+
+			if nearby, err := core.QueryNearby(ctx, 52.37, 4.89, 50, 10); err != nil || len(nearby) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not find locations far away: %v, %v.", tests.Failed, testID, nearby, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find locations far away.", tests.Success, testID)
+
+			if _, err := core.QueryNearby(ctx, 91, 0, 50, 10); err != geo.ErrValidation {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a latitude out of range: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept a latitude out of range.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen looking up an ip in memory.", testID)
+		{
+			ctx := context.Background()
+
+			index := geo.NewIndex(test.Log, test.DB)
+			if _, err := index.QueryByIP(ctx, "10.2.0.1"); err != geo.ErrIndexNotLoaded {
+				t.Fatalf("\t%s\tTest %d:\tShould not serve lookups before loading: %v.", tests.Failed, testID, err)
+			}
+
+			if err := index.Load(ctx); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the index: %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the index.", tests.Success, testID)
+
+			for _, ip := range []string{"10.2.0.1", "::ffff:10.255.255.255", "10.1.0.1", "11.0.0.1", "12345"} {
+				exp, expErr := core.QueryByIP(ctx, ip)
+				got, err := index.QueryByIP(ctx, ip)
+				if err != expErr {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same error for %s as the database: %v, expected %v.", tests.Failed, testID, ip, err, expErr)
+				}
+
+				if diff := cmp.Diff(exp, got); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same location for %s as the database. Diff:\n%s", tests.Failed, testID, ip, diff)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same results as the database.", tests.Success, testID)
+
+			ips := []string{"10.2.0.1", "10.1.0.1", "12345", "11.0.0.1"}
+			exp, err := core.QueryByIPs(ctx, ips)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up many ips: %s.", tests.Failed, testID, err)
+			}
+			got, err := index.QueryByIPs(ctx, ips)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up many ips in memory: %s.", tests.Failed, testID, err)
+			}
+			for i := range exp {
+				if got[i].Err != exp[i].Err {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same error for %s as the database: %v, expected %v.", tests.Failed, testID, ips[i], got[i].Err, exp[i].Err)
+				}
+				if diff := cmp.Diff(exp[i].Geo, got[i].Geo); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the same location for %s as the database. Diff:\n%s", tests.Failed, testID, ips[i], diff)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same results for many ips as the database.", tests.Success, testID)
+
+			if reloaded, err := index.Reload(ctx); err != nil || reloaded {
+				t.Fatalf("\t%s\tTest %d:\tShould not reload the same generation: %v, %v.", tests.Failed, testID, reloaded, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not reload the same generation.", tests.Success, testID)
+		}
+	}
+}
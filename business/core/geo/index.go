@@ -0,0 +1,391 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/generation"
+	"github.com/mchusovlianov/geodata/business/data/page"
+	"go.uber.org/zap"
+	"net/netip"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIndexNotLoaded is returned by lookups of an index which wasn't loaded yet.
+var ErrIndexNotLoaded = errors.New("index not loaded")
+
+// loadAttempts limits how many times a load is repeated when an import makes a
+// new generation current while the tables are read.
+const loadAttempts = 3
+
+// Querier reads locations with their cities and countries by ip or around a
+// position. Core, Index and Cache implement it.
+type Querier interface {
+	QueryByIP(ctx context.Context, ip string) (Geo, error)
+	QueryByIPs(ctx context.Context, ips []string) ([]IPLookup, error)
+	QueryNearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]NearbyGeo, error)
+}
+
+// Index serves lookups from an in-memory copy of the dataset. The ip ranges are
+// flattened into sorted segments which don't overlap, each one pointing to the
+// most specific location of its addresses, so a lookup is a binary search.
+// A reload builds a new copy and swaps it in atomically. Nearby searches are
+// passed to the database.
+type Index struct {
+	log      *zap.SugaredLogger
+	db       *sqlx.DB
+	core     Core
+	snapshot atomic.Value // *snapshot
+}
+
+// NewIndex constructs an index reading the dataset from the database. It must be
+// loaded before the lookups.
+func NewIndex(log *zap.SugaredLogger, db *sqlx.DB) *Index {
+	return &Index{
+		log:  log,
+		db:   db,
+		core: NewCore(log, db, nil),
+	}
+}
+
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address with its city and country from memory.
+func (idx *Index) QueryByIP(ctx context.Context, ip string) (Geo, error) {
+	_, span := tracer.Start(ctx, "business.core.geo.index.querybyip")
+	defer span.End()
+
+	snap, _ := idx.snapshot.Load().(*snapshot)
+	if snap == nil {
+		return Geo{}, ErrIndexNotLoaded
+	}
+
+	addr, err := location.ParseIP(ip)
+	if err != nil {
+		return Geo{}, ErrValidation
+	}
+
+	return snap.lookup(addr)
+}
+
+// QueryByIPs gets the location with the most specific ip range containing each
+// of the ip-addresses with its city and country from memory, in the order of
+// the addresses.
+func (idx *Index) QueryByIPs(ctx context.Context, ips []string) ([]IPLookup, error) {
+	_, span := tracer.Start(ctx, "business.core.geo.index.querybyips")
+	defer span.End()
+
+	snap, _ := idx.snapshot.Load().(*snapshot)
+	if snap == nil {
+		return nil, ErrIndexNotLoaded
+	}
+
+	lookups := make([]IPLookup, len(ips))
+	for i, ip := range ips {
+		lookups[i].IP = ip
+
+		addr, err := location.ParseIP(ip)
+		if err != nil {
+			lookups[i].Err = ErrValidation
+			continue
+		}
+
+		lookups[i].Geo, lookups[i].Err = snap.lookup(addr)
+	}
+
+	return lookups, nil
+}
+
+// QueryNearby gets up to limit locations with their cities and countries within
+// the radius in kilometres of the position from the database, see Core.
+func (idx *Index) QueryNearby(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]NearbyGeo, error) {
+	return idx.core.QueryNearby(ctx, lat, lon, radiusKm, limit)
+}
+
+// Load reads the current generation of the dataset and makes it the one the
+// lookups are served from.
+func (idx *Index) Load(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+
+		gen, err := currentGeneration(ctx, idx.db)
+		if err != nil {
+			return err
+		}
+
+		snap, err := idx.read(ctx, gen)
+		if err != nil {
+			return err
+		}
+
+		// an import could promote a new generation while the tables were read
+		after, err := currentGeneration(ctx, idx.db)
+		if err != nil {
+			return err
+		}
+		if after != gen {
+			if attempt == loadAttempts {
+				return fmt.Errorf("generation changed while loading %d times", attempt)
+			}
+			continue
+		}
+
+		idx.snapshot.Store(snap)
+
+		// the heap of the whole process, the copy included, not the copy alone
+		idx.log.Infow("index loaded", "generation", gen, "locations", len(snap.locations),
+			"segments", len(snap.starts), "duration", time.Since(start),
+			"processHeapMB", float64(heapAlloc())/(1<<20))
+
+		return nil
+	}
+}
+
+// Reload loads the dataset again if another generation became current since the
+// last load. It reports whether the index was reloaded.
+func (idx *Index) Reload(ctx context.Context) (bool, error) {
+	gen, err := currentGeneration(ctx, idx.db)
+	if err != nil {
+		return false, err
+	}
+
+	if snap, _ := idx.snapshot.Load().(*snapshot); snap != nil && snap.generation == gen {
+		return false, nil
+	}
+
+	if err := idx.Load(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Watch reloads the index every interval until the context is cancelled. A
+// failed reload keeps serving the loaded dataset.
+func (idx *Index) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := idx.Reload(ctx); err != nil && ctx.Err() == nil {
+				idx.log.Errorw("index reload", "ERROR", err)
+			}
+		}
+	}
+}
+
+// read reads the three tables and builds the snapshot of the generation.
+func (idx *Index) read(ctx context.Context, gen int64) (*snapshot, error) {
+	locations, err := readPages(ctx, "uuid", location.NewCore(idx.log, idx.db, nil).QueryPage)
+	if err != nil {
+		return nil, fmt.Errorf("reading locations: %w", err)
+	}
+
+	cities, err := readPages(ctx, "name", city.NewCore(idx.log, idx.db, nil).QueryPage)
+	if err != nil {
+		return nil, fmt.Errorf("reading cities: %w", err)
+	}
+
+	countries, err := readPages(ctx, "name", country.NewCore(idx.log, idx.db, nil).QueryPage)
+	if err != nil {
+		return nil, fmt.Errorf("reading countries: %w", err)
+	}
+
+	return newSnapshot(gen, locations, cities, countries)
+}
+
+// readPages reads all items of a list sorted by the field page after page.
+func readPages[T any](ctx context.Context, sort string, query func(context.Context, page.Query) (page.Page[T], error)) ([]T, error) {
+	var items []T
+
+	q := page.Query{Sort: sort, Limit: page.MaxLimit}
+	for {
+		p, err := query(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, p.Items...)
+
+		if p.NextCursor == "" {
+			return items, nil
+		}
+		q.Cursor = p.NextCursor
+	}
+}
+
+// currentGeneration returns the identifier of the live generation, zero if the
+// dataset was never imported.
+func currentGeneration(ctx context.Context, db *sqlx.DB) (int64, error) {
+	gen, err := generation.QueryCurrent(ctx, db)
+	if err != nil {
+		if errors.Is(err, generation.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("query generation: %w", err)
+	}
+
+	return gen.ID, nil
+}
+
+// heapAlloc returns the bytes of allocated heap objects, including the ones not
+// collected yet.
+func heapAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// =============================================================================
+
+// noLocation marks a segment of addresses outside of all ranges.
+const noLocation = -1
+
+// snapshot is an immutable copy of one generation of the dataset.
+type snapshot struct {
+	generation int64
+	starts     []netip.Addr // first addresses of the segments in ascending order.
+	owners     []int32      // index of the location of each segment or noLocation.
+	locations  []location.Location
+	cities     map[string]city.City
+	countries  map[string]country.Country
+}
+
+// lookup finds the segment containing the address. Addresses are compared as
+// 16 byte keys like the database does.
+func (s *snapshot) lookup(addr netip.Addr) (Geo, error) {
+	key := netip.AddrFrom16(addr.As16())
+
+	i := sort.Search(len(s.starts), func(i int) bool {
+		return key.Less(s.starts[i])
+	}) - 1
+	if i < 0 || s.owners[i] == noLocation {
+		return Geo{}, ErrNotFound
+	}
+
+	loc := s.locations[s.owners[i]]
+	cit, ok := s.cities[loc.CityUUID]
+	if !ok {
+		return Geo{}, ErrNotFound
+	}
+
+	countr, ok := s.countries[cit.CountryUUID]
+	if !ok {
+		return Geo{}, ErrNotFound
+	}
+
+	return Geo{Location: loc, Country: countr, City: cit}, nil
+}
+
+// keyRange is the ip range of a location as 16 byte keys.
+type keyRange struct {
+	from, to netip.Addr
+	owner    int32
+}
+
+// newSnapshot flattens the ranges of the locations into segments. Of the ranges
+// containing an address the one starting last and, of those, ending first wins,
+// the same way the database query orders them.
+func newSnapshot(gen int64, locations []location.Location, cities []city.City, countries []country.Country) (*snapshot, error) {
+	s := snapshot{
+		generation: gen,
+		locations:  locations,
+		cities:     make(map[string]city.City, len(cities)),
+		countries:  make(map[string]country.Country, len(countries)),
+	}
+
+	for _, cit := range cities {
+		s.cities[cit.UUID] = cit
+	}
+	for _, countr := range countries {
+		s.countries[countr.UUID] = countr
+	}
+
+	ranges := make([]keyRange, len(locations))
+	for i, loc := range locations {
+		r, err := location.ParseIPRange(loc.IP)
+		if err != nil {
+			return nil, fmt.Errorf("location[%s]: %w", loc.UUID, err)
+		}
+
+		ranges[i] = keyRange{
+			from:  netip.AddrFrom16(r.From.As16()),
+			to:    netip.AddrFrom16(r.To.As16()),
+			owner: int32(i),
+		}
+	}
+
+	// outer ranges go first, so a later range always wins over the earlier ones
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].from != ranges[j].from {
+			return ranges[i].from.Less(ranges[j].from)
+		}
+		return ranges[j].to.Less(ranges[i].to)
+	})
+
+	// open holds the ranges which started, the last one still open is the winner
+	var open []keyRange
+
+	// closeBefore closes the ranges ending before the address, the zero address
+	// closes all of them.
+	closeBefore := func(addr netip.Addr) {
+		for len(open) > 0 {
+			top := open[len(open)-1]
+			if addr.IsValid() && !top.to.Less(addr) {
+				return
+			}
+
+			// ranges under the closed one which ended earlier are closed too
+			open = open[:len(open)-1]
+			for len(open) > 0 && !top.to.Less(open[len(open)-1].to) {
+				open = open[:len(open)-1]
+			}
+
+			next := top.to.Next()
+			if !next.IsValid() {
+				continue
+			}
+
+			owner := int32(noLocation)
+			if len(open) > 0 {
+				owner = open[len(open)-1].owner
+			}
+			s.add(next, owner)
+		}
+	}
+
+	for _, r := range ranges {
+		closeBefore(r.from)
+		open = append(open, r)
+		s.add(r.from, r.owner)
+	}
+	closeBefore(netip.Addr{})
+
+	return &s, nil
+}
+
+// add starts a segment at the address. A segment starting at the same address is
+// replaced, one with the same owner as the previous segment is merged into it.
+func (s *snapshot) add(start netip.Addr, owner int32) {
+	n := len(s.starts)
+	if n > 0 && s.starts[n-1] == start {
+		s.starts, s.owners = s.starts[:n-1], s.owners[:n-1]
+		n--
+	}
+
+	if n > 0 && s.owners[n-1] == owner {
+		return
+	}
+
+	s.starts = append(s.starts, start)
+	s.owners = append(s.owners, owner)
+}
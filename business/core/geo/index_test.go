@@ -0,0 +1,98 @@
+package geo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func Test_IndexSnapshot(t *testing.T) {
+	countries := []country.Country{{UUID: "country", Code: "NL"}}
+	cities := []city.City{{UUID: "city", CountryUUID: "country"}}
+
+	t.Log("Given the need to look up ips in memory the same way the database does.")
+	{
+		rnd := rand.New(rand.NewSource(1))
+
+		for testID := 0; testID < 20; testID++ {
+			t.Logf("\tTest %d:\tWhen flattening random nested and overlapping ranges.", testID)
+			{
+				// ranges of 10.0.0.0/24 and one IPv6 range covering the IPv4 keys
+				seen := make(map[string]bool)
+				var locations []location.Location
+				for len(locations) < 12 {
+					from, to := rnd.Intn(256), rnd.Intn(256)
+					if from > to {
+						from, to = to, from
+					}
+
+					ip := location.IPRange{
+						From: netip.AddrFrom4([4]byte{10, 0, 0, byte(from)}),
+						To:   netip.AddrFrom4([4]byte{10, 0, 0, byte(to)}),
+					}.String()
+					if seen[ip] {
+						continue
+					}
+					seen[ip] = true
+
+					locations = append(locations, location.Location{UUID: fmt.Sprint(len(locations)), CityUUID: "city", IP: ip})
+				}
+				if testID%2 == 0 {
+					locations = append(locations, location.Location{UUID: "v6", CityUUID: "city", IP: "::/0"})
+				}
+
+				snap, err := newSnapshot(1, locations, cities, countries)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to build the snapshot: %s.", tests.Failed, testID, err)
+				}
+
+				addrs := []netip.Addr{netip.MustParseAddr("9.255.255.255"), netip.MustParseAddr("10.0.1.0"), netip.MustParseAddr("2001:db8::1")}
+				for i := 0; i < 256; i++ {
+					addrs = append(addrs, netip.AddrFrom4([4]byte{10, 0, 0, byte(i)}))
+				}
+
+				for _, addr := range addrs {
+					exp := mostSpecific(locations, addr)
+
+					g, err := snap.lookup(addr)
+					got := ""
+					if err == nil {
+						got = g.Location.UUID
+					}
+
+					if got != exp {
+						t.Fatalf("\t%s\tTest %d:\tShould find location %q for %s, got %q.", tests.Failed, testID, exp, addr, got)
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould find the most specific location of each ip.", tests.Success, testID)
+			}
+		}
+	}
+}
+
+// mostSpecific finds the location of the address by checking every range.
+func mostSpecific(locations []location.Location, addr netip.Addr) string {
+	key := location.IPKey(addr)
+
+	var best string
+	var bestFrom, bestTo []byte
+	for _, loc := range locations {
+		r, _ := location.ParseIPRange(loc.IP)
+		from, to := location.IPKey(r.From), location.IPKey(r.To)
+		if bytes.Compare(from, key) > 0 || bytes.Compare(to, key) < 0 {
+			continue
+		}
+
+		if best == "" || bytes.Compare(from, bestFrom) > 0 || (bytes.Equal(from, bestFrom) && bytes.Compare(to, bestTo) < 0) {
+			best, bestFrom, bestTo = loc.UUID, from, to
+		}
+	}
+
+	return best
+}
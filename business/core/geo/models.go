@@ -0,0 +1,47 @@
+package geo
+
+import (
+	"github.com/mchusovlianov/geodata/business/core/city"
+	"github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/geo/db"
+	"github.com/mchusovlianov/geodata/business/core/location"
+)
+
+// Geo is a location together with its city and country.
+type Geo struct {
+	Location location.Location `json:"location"`
+	Country  country.Country   `json:"country"`
+	City     city.City         `json:"city"`
+}
+
+// IPLookup is the result of looking up a single ip-address of many.
+type IPLookup struct {
+	IP  string // IP-address as it was asked.
+	Geo Geo    // Location with the most specific range containing the ip.
+	Err error  // ErrValidation or ErrNotFound if there is no location.
+}
+
+// NearbyGeo is a location with its city and country found near a position.
+type NearbyGeo struct {
+	Geo
+	DistanceKm float64 `json:"distance_km"` // Distance from the position.
+}
+
+func toGeo(dbGeo db.Geo) Geo {
+	return Geo{
+		Location: location.FromDB(dbGeo.Location),
+		Country:  country.FromDB(dbGeo.Country),
+		City:     city.FromDB(dbGeo.City),
+	}
+}
+
+func toNearbyGeoSlice(dbGeos []db.NearbyGeo) []NearbyGeo {
+	geos := make([]NearbyGeo, len(dbGeos))
+	for i, dbGeo := range dbGeos {
+		geos[i] = NearbyGeo{
+			Geo:        toGeo(dbGeo.Geo),
+			DistanceKm: dbGeo.DistanceKm,
+		}
+	}
+	return geos
+}
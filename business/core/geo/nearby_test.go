@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"github.com/mchusovlianov/geodata/foundation/geohash"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func Test_CoverCells(t *testing.T) {
+	t.Log("Given the need to cover circles around positions with geohash cells.")
+	{
+		rnd := rand.New(rand.NewSource(1))
+
+		for testID := 0; testID < 50; testID++ {
+			lat, lon := rnd.Float64()*170-85, rnd.Float64()*360-180
+			radiusKm := math.Pow(10, rnd.Float64()*3)
+			dLat := radiusKm / geohash.EarthRadiusKm * 180 / math.Pi
+
+			t.Logf("\tTest %d:\tWhen searching %.0f km around [%f, %f].", testID, radiusKm, lat, lon)
+			{
+				cells := coverCells(lat, lon, dLat)
+				if cells == nil {
+					t.Logf("\t%s\tTest %d:\tShould search a latitude band without cells.", tests.Success, testID)
+					continue
+				}
+
+				// positions on the circle are the farthest ones
+				for i := 0; i < 360; i++ {
+					pLat, pLon := destination(lat, lon, radiusKm*0.999, float64(i))
+					hash := geohash.Encode(pLat, pLon, geohash.MaxPrecision)
+
+					covered := false
+					for _, cell := range cells {
+						covered = covered || strings.HasPrefix(hash, cell)
+					}
+					if !covered {
+						t.Fatalf("\t%s\tTest %d:\tShould cover [%f, %f] by cells %v.", tests.Failed, testID, pLat, pLon, cells)
+					}
+				}
+				t.Logf("\t%s\tTest %d:\tShould cover the circle by %d cells of %d characters.", tests.Success, testID, len(cells), len(cells[0]))
+			}
+		}
+	}
+}
+
+// destination returns the position at the distance in kilometres from the start
+// in the direction of the bearing in degrees.
+func destination(lat, lon, distanceKm, bearing float64) (float64, float64) {
+	phi1, lambda1 := lat*math.Pi/180, lon*math.Pi/180
+	delta, theta := distanceKm/geohash.EarthRadiusKm, bearing*math.Pi/180
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+
+	lon2 := math.Mod(lambda2*180/math.Pi+540, 360) - 180
+	return phi2 * 180 / math.Pi, lon2
+}
@@ -1,42 +1,133 @@
 package importer
 
-import "fmt"
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Set of fields the importer reads from every csv line.
+const (
+	FieldIP           = "ip_address"
+	FieldCountryCode  = "country_code"
+	FieldCountry      = "country"
+	FieldCity         = "city"
+	FieldLatitude     = "latitude"
+	FieldLongitude    = "longitude"
+	FieldMysteryValue = "mystery_value"
+)
 
 // =========================================================================
-// headers array defines order and names of columns which this code is considered to get as input
-var headers = [...]string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"}
+// fields array defines names of columns which this code requires to get as input
+var fields = [...]string{FieldIP, FieldCountryCode, FieldCountry, FieldCity, FieldLatitude, FieldLongitude, FieldMysteryValue}
+
+// Mapping describes how a csv file is read and how its columns are mapped to
+// the fields. Columns are matched by their header, so the order of columns
+// doesn't matter. The quote character is always '"' as encoding/csv doesn't
+// allow to change it.
+type Mapping struct {
+	Aliases          map[string]string // Header names accepted for a field: alias -> field.
+	IgnoreExtra      bool              // Skip columns which are not mapped to any field.
+	Delimiter        rune              // Field delimiter, ',' if not set.
+	LazyQuotes       bool              // Allow quotes in unquoted fields and non-doubled quotes in quoted fields.
+	TrimLeadingSpace bool              // Ignore leading white space in fields.
+}
+
+// DefaultMapping returns the mapping for files with the original vendor
+// headers. Extra columns are ignored.
+func DefaultMapping() Mapping {
+	return Mapping{
+		IgnoreExtra: true,
+		Delimiter:   ',',
+	}
+}
 
-// map to easy get column index in csv line
-var headersReverseMap map[string]int
+// newReader constructs a csv reader configured by the mapping.
+func (m Mapping) newReader(r io.Reader) *csv.Reader {
+	csvReader := csv.NewReader(r)
+	if m.Delimiter != 0 {
+		csvReader.Comma = m.Delimiter
+	}
+	csvReader.LazyQuotes = m.LazyQuotes
+	csvReader.TrimLeadingSpace = m.TrimLeadingSpace
+
+	return csvReader
+}
+
+// columns keeps indexes of the fields in csv lines of a particular file.
+type columns struct {
+	ip           int
+	countryCode  int
+	country      int
+	city         int
+	latitude     int
+	longitude    int
+	mysteryValue int
+}
 
-func getRecordValue(columnName string) (int, error) {
-	if headersReverseMap == nil {
-		headersReverseMap = make(map[string]int)
-		for index, headerName := range headers {
-			headersReverseMap[headerName] = index
+// detectColumns finds the index of every field in the header line.
+func (m Mapping) detectColumns(headLine []string) (columns, error) {
+	aliases := make(map[string]string, len(fields)+len(m.Aliases))
+	for _, field := range fields {
+		aliases[field] = field
+	}
+	for alias, field := range m.Aliases {
+		aliases[normalizeHeader(alias)] = field
+	}
+
+	indexes := make(map[string]int, len(fields))
+	for i, header := range headLine {
+		field, ok := aliases[normalizeHeader(header)]
+		if !ok {
+			if m.IgnoreExtra {
+				continue
+			}
+			return columns{}, fmt.Errorf("%w: unknown column %q", ErrNotValidFormat, header)
+		}
+
+		if _, ok := indexes[field]; ok {
+			return columns{}, fmt.Errorf("%w: column %q is mapped twice", ErrNotValidFormat, field)
 		}
+		indexes[field] = i
 	}
 
-	index, ok := headersReverseMap[columnName]
-	if !ok {
-		return -1, fmt.Errorf("field with name %s not found", columnName)
+	for _, field := range fields {
+		if _, ok := indexes[field]; !ok {
+			return columns{}, fmt.Errorf("%w: missing column %q", ErrNotValidFormat, field)
+		}
 	}
 
-	return index, nil
+	return columns{
+		ip:           indexes[FieldIP],
+		countryCode:  indexes[FieldCountryCode],
+		country:      indexes[FieldCountry],
+		city:         indexes[FieldCity],
+		latitude:     indexes[FieldLatitude],
+		longitude:    indexes[FieldLongitude],
+		mysteryValue: indexes[FieldMysteryValue],
+	}, nil
 }
 
-func checkFileFormat(headLine []string) bool {
-	if len(headLine) != len(headers) {
-		return false
+// validate checks the mapping refers to known fields only.
+func (m Mapping) validate() error {
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field] = true
 	}
 
-	isValid := headLine[0] == headers[0] &&
-		headLine[1] == headers[1] &&
-		headLine[2] == headers[2] &&
-		headLine[3] == headers[3] &&
-		headLine[4] == headers[4] &&
-		headLine[5] == headers[5] &&
-		headLine[6] == headers[6]
+	for alias, field := range m.Aliases {
+		if !known[field] {
+			return fmt.Errorf("alias %q refers to unknown field %q", alias, field)
+		}
+	}
+
+	return nil
+}
 
-	return isValid
+// normalizeHeader makes header names comparable: trimmed, lower-cased and
+// without the utf-8 byte order mark some tools put in front of a file.
+func normalizeHeader(header string) string {
+	header = strings.TrimPrefix(header, "\ufeff")
+	return strings.ToLower(strings.TrimSpace(header))
 }
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mchusovlianov/geodata/business/data/tests"
+)
+
+func Test_DetectColumns(t *testing.T) {
+	t.Log("Given the need to map csv columns to the fields.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the header has reordered, aliased and extra columns.", testID)
+		{
+			m := DefaultMapping()
+			m.Aliases = map[string]string{"IP": FieldIP, "lat": FieldLatitude}
+
+			header := strings.Split("\ufeffcity,Lat, longitude,extra,ip,country,country_code,mystery_value", ",")
+			cols, err := m.detectColumns(header)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to detect columns: %s.", tests.Failed, testID, err)
+			}
+
+			exp := columns{ip: 4, countryCode: 6, country: 5, city: 0, latitude: 1, longitude: 2, mysteryValue: 7}
+			if cols != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected columns. Got %+v, expected %+v.", tests.Failed, testID, cols, exp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to detect columns.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen the header doesn't match the mapping.", testID)
+		{
+			m := DefaultMapping()
+			m.IgnoreExtra = false
+
+			headers := []string{
+				"country_code,country,city,latitude,longitude,mystery_value",
+				"ip_address,country_code,country,city,latitude,longitude,mystery_value,extra",
+				"ip_address,ip_address,country_code,country,city,latitude,longitude,mystery_value",
+			}
+			for _, header := range headers {
+				if _, err := m.detectColumns(strings.Split(header, ",")); !errors.Is(err, ErrNotValidFormat) {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to detect columns of %q: %v.", tests.Failed, testID, header, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to detect columns.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen an alias refers to an unknown field.", testID)
+		{
+			m := DefaultMapping()
+			m.Aliases = map[string]string{"ip": "address"}
+
+			if err := m.validate(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept the mapping.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept the mapping.", tests.Success, testID)
+		}
+	}
+}
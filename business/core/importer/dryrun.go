@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	cityCore "github.com/mchusovlianov/geodata/business/core/city"
+	countryCore "github.com/mchusovlianov/geodata/business/core/country"
+	locationCore "github.com/mchusovlianov/geodata/business/core/location"
+	"io"
+	"time"
+)
+
+// dryRunUUID stands for uuids of countries and cities while validating, as
+// they are only known once the records are created.
+const dryRunUUID = "dry-run"
+
+// validateFile reads the whole file and checks every line with the rules the
+// import applies without writing anything to the database. Duplicated ips are
+// detected within the file only.
+func (c *Core) validateFile(ctx context.Context, src Source) (Statistic, error) {
+	csvReader := c.mapping.newReader(src.Reader)
+
+	st := Statistic{}
+	start := time.Now()
+
+	c.lines.Store(0)
+	c.good.Store(0)
+	c.failed.Store(0)
+	c.rejects.reset()
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return Statistic{}, ErrNotValidFormat
+	}
+	if err != nil {
+		return Statistic{}, err
+	}
+	st.TotalLines += 1
+	c.lines.Inc()
+
+	cols, err := c.mapping.detectColumns(header)
+	if err != nil {
+		return Statistic{}, err
+	}
+	c.rejects.header(header)
+
+	validate := validator.New()
+	ips := make(map[string]struct{})
+
+	for ctx.Err() == nil {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return Statistic{}, err
+		}
+
+		if len(record) == 0 {
+			continue
+		}
+
+		st.TotalLines += 1
+		c.lines.Inc()
+		line := st.TotalLines
+
+		values, reason := parseLine(cols, record)
+		if reason != "" {
+			c.reject(line, record, reason)
+			continue
+		}
+
+		if !validLine(validate, values) {
+			c.reject(line, record, ReasonValidation)
+			continue
+		}
+
+		if _, ok := ips[values.ip]; ok {
+			c.reject(line, record, ReasonDuplicateIP)
+			continue
+		}
+		ips[values.ip] = struct{}{}
+
+		c.good.Inc()
+
+		if st.TotalLines%10000 == 0 {
+			c.log.Infow("validated", "lines", st.TotalLines)
+		}
+	}
+
+	st.GoodLines = int(c.good.Load())
+	st.FailedLines = int(c.failed.Load())
+	st.FailureReasons = c.rejects.counts()
+
+	if err := c.rejects.flush(); err != nil {
+		c.log.Errorw("writing rejects", "ERROR", err)
+	}
+
+	st.Duration = time.Since(start)
+	if ctx.Err() != nil {
+		return st, fmt.Errorf("%w: %s", ErrInterrupted, ctx.Err())
+	}
+
+	return st, nil
+}
+
+// validLine checks the values against the validation rules of the country,
+// city and location cores.
+func validLine(validate *validator.Validate, values lineValues) bool {
+	if err := validate.Struct(countryCore.NewCountry{
+		Name: values.countryName,
+		Code: values.countryCode,
+	}); err != nil {
+		return false
+	}
+
+	if err := validate.Struct(cityCore.NewCity{
+		Name:        values.cityName,
+		CountryUUID: dryRunUUID,
+	}); err != nil {
+		return false
+	}
+
+	err := validate.Struct(locationCore.NewLocation{
+		IP:           values.ip,
+		Longitude:    values.longitude,
+		Latitude:     values.latitude,
+		MysteryValue: values.mysteryValue,
+		CityUUID:     dryRunUUID,
+	})
+
+	return err == nil
+}
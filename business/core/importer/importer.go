@@ -2,12 +2,14 @@ package importer
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	cityCore "github.com/mchusovlianov/geodata/business/core/city"
 	countryCore "github.com/mchusovlianov/geodata/business/core/country"
+	"github.com/mchusovlianov/geodata/business/core/importrun"
 	locationCore "github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/generation"
 	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"io"
@@ -17,106 +19,328 @@ import (
 )
 
 var (
-	ErrNotValidFormat = errors.New("file in wrong format")
+	ErrNotValidFormat  = errors.New("file in wrong format")
+	ErrNothingImported = errors.New("no lines were imported")
+	ErrSeenIncomplete  = errors.New("not all ips of the file were recorded")
+	ErrInterrupted     = errors.New("import interrupted")
 )
 
-const taskChanSize = 10
+const (
+	taskChanSize           = 10
+	defaultBatchSize       = 500
+	defaultCheckpointEvery = 100000
 
+	// maxBatchSize keeps a multi-row insert of locations (8 columns) under
+	// the limit of 65535 placeholders per prepared statement in mysql.
+	maxBatchSize = 8000
+)
+
+// Statistic is the result of an import. FailureReasons counts failed lines by
+// reason, lines skipped on resume are not included into it. The same holds for
+// the counts of inserted, updated and unchanged locations. Updated, Unchanged
+// and Deleted are counted by delta imports only.
 type Statistic struct {
-	TotalLines  int
-	FailedLines int
-	GoodLines   int
-	Duration    time.Duration
+	TotalLines     int
+	FailedLines    int
+	GoodLines      int
+	FailureReasons map[string]int
+	Inserted       int
+	Updated        int
+	Unchanged      int
+	Deleted        int
+	Duration       time.Duration
+}
+
+// Progress tells how far a running import got. Lines skipped on resume are
+// counted as read, their good and failed lines are continued from the checkpoint.
+type Progress struct {
+	Lines     int `json:"lines"`     // Lines read from the file so far.
+	Good      int `json:"good"`      // Lines stored.
+	Failed    int `json:"failed"`    // Lines rejected.
+	Inserted  int `json:"inserted"`  // Locations inserted.
+	Updated   int `json:"updated"`   // Locations updated by a delta import.
+	Unchanged int `json:"unchanged"` // Locations left unchanged by a delta import.
+}
+
+// Options represent optional parameters.
+type Options struct {
+	batchSize       int
+	checkpointEvery int
+	rejects         io.Writer
+	mapping         Mapping
+	dryRun          bool
+	delta           bool
+	deleteMissing   bool
+}
+
+// WithBatchSize sets how many locations a worker buffers before flushing them
+// to the database with a single multi-row insert.
+func WithBatchSize(size int) func(opts *Options) {
+	return func(opts *Options) {
+		opts.batchSize = size
+	}
+}
+
+// WithCheckpointEvery sets after how many lines the progress of an import is
+// committed, so an interrupted import can be resumed from there.
+func WithCheckpointEvery(lines int) func(opts *Options) {
+	return func(opts *Options) {
+		opts.checkpointEvery = lines
+	}
+}
+
+// WithRejects sets the output for failed lines. Every failed line is written
+// as csv with the original columns followed by the line number and the reason.
+func WithRejects(w io.Writer) func(opts *Options) {
+	return func(opts *Options) {
+		opts.rejects = w
+	}
+}
+
+// WithMapping sets how columns of csv files are mapped to the fields and how
+// the files are parsed.
+func WithMapping(mapping Mapping) func(opts *Options) {
+	return func(opts *Options) {
+		opts.mapping = mapping
+	}
 }
 
-// Core manages the set of APIs for location access.
+// WithDryRun makes Import only parse and validate the file. The database is
+// not touched, so the core can be constructed without connections.
+func WithDryRun() func(opts *Options) {
+	return func(opts *Options) {
+		opts.dryRun = true
+	}
+}
+
+// WithDelta makes Import apply the file to the live records instead of
+// replacing them. Locations are upserted by ip and, if deleteMissing is set,
+// locations with ips absent from the file are deleted.
+func WithDelta(deleteMissing bool) func(opts *Options) {
+	return func(opts *Options) {
+		opts.delta = true
+		opts.deleteMissing = deleteMissing
+	}
+}
+
+// Core manages the set of APIs for location access. Records are imported into
+// the staging schema and promoted to the live one when the import succeeds.
 type Core struct {
-	db     *sqlx.DB
-	log    *zap.SugaredLogger
-	good   atomic.Int32
-	failed atomic.Int32
+	db              *sqlx.DB
+	staging         *sqlx.DB
+	log             *zap.SugaredLogger
+	runs            importrun.Core
+	batchSize       int
+	checkpointEvery int
+	mapping         Mapping
+	rejects         *rejects
+	dryRun          bool
+	delta           bool
+	deleteMissing   bool
+	replayUntil     int
+	lines           atomic.Int32
+	good            atomic.Int32
+	failed          atomic.Int32
+	inserted        atomic.Int32
+	updated         atomic.Int32
+	unchanged       atomic.Int32
+	seenFailed      atomic.Bool
 }
 
-// NewCore constructs a core for location api access.
-func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB) (Core, error) {
+// NewCore constructs a core for location api access. The staging connection
+// has to point to the staging schema of the live database.
+func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, stagingConn *sqlx.DB, options ...func(opts *Options)) (Core, error) {
+	opts := Options{
+		batchSize:       defaultBatchSize,
+		checkpointEvery: defaultCheckpointEvery,
+		mapping:         DefaultMapping(),
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	if opts.batchSize <= 0 || opts.batchSize > maxBatchSize {
+		return Core{}, fmt.Errorf("batch size must be between 1 and %d, got %d", maxBatchSize, opts.batchSize)
+	}
+
+	if opts.checkpointEvery <= 0 {
+		return Core{}, fmt.Errorf("checkpoint interval must be positive, got %d", opts.checkpointEvery)
+	}
+
+	if err := opts.mapping.validate(); err != nil {
+		return Core{}, fmt.Errorf("column mapping: %w", err)
+	}
+
 	return Core{
-		log: log,
-		db:  dbConn,
+		log:             log,
+		db:              dbConn,
+		staging:         stagingConn,
+		runs:            importrun.NewCore(log, dbConn, nil),
+		batchSize:       opts.batchSize,
+		checkpointEvery: opts.checkpointEvery,
+		mapping:         opts.mapping,
+		rejects:         newRejects(opts.rejects),
+		dryRun:          opts.dryRun,
+		delta:           opts.delta,
+		deleteMissing:   opts.deleteMissing,
 	}, nil
 }
 
-// worker - worker function to parse csv file and import to the database
-func (c *Core) worker(wg *sync.WaitGroup, tasks chan []string) error {
+// task is a unit of work for a worker: either a csv record or a barrier which
+// asks the worker to flush its batch and report back.
+type task struct {
+	line    int
+	record  []string
+	barrier *sync.WaitGroup
+}
+
+// pendingCity is a city which is not in the database yet. It is created
+// right before the locations referencing it are flushed.
+type pendingCity struct {
+	countryCode string
+	city        cityCore.NewCity
+}
+
+// pendingLocation is a parsed csv line waiting to be flushed. The city uuid is
+// resolved during the flush as the city itself might still be pending.
+type pendingLocation struct {
+	line     int
+	record   []string
+	cityKey  string
+	location locationCore.NewLocation
+}
+
+// batch keeps the records a worker buffers between two flushes.
+type batch struct {
+	cities    []pendingCity
+	cityKeys  map[string]struct{}
+	locations []pendingLocation
+	seen      []string
+}
+
+func newBatch(size int) *batch {
+	return &batch{
+		cityKeys:  make(map[string]struct{}),
+		locations: make([]pendingLocation, 0, size),
+	}
+}
+
+// reset empties the batch keeping the allocated memory.
+func (b *batch) reset() {
+	b.cities = b.cities[:0]
+	b.locations = b.locations[:0]
+	b.seen = b.seen[:0]
+	for key := range b.cityKeys {
+		delete(b.cityKeys, key)
+	}
+}
+
+// reject accounts a failed csv line with the reason of the failure.
+func (c *Core) reject(line int, record []string, reason string) {
+	c.failed.Inc()
+	c.rejects.add(line, record, reason)
+}
+
+// lineValues are the values of a csv line converted to the types they are
+// stored with.
+type lineValues struct {
+	ip           string
+	countryCode  string
+	countryName  string
+	cityName     string
+	latitude     float64
+	longitude    float64
+	mysteryValue int64
+}
+
+// parseLine converts the fields of a csv record. The ip range is converted to
+// its canonical form first, so it is known even if another field fails. It
+// returns the reason of the failure if a field can't be converted or is out of
+// range.
+func parseLine(cols columns, record []string) (lineValues, string) {
+	ipRange, err := locationCore.ParseIPRange(record[cols.ip])
+	if err != nil {
+		return lineValues{}, ReasonBadIP
+	}
+	ip := ipRange.String()
+
+	mysteryValue, err := strconv.ParseInt(record[cols.mysteryValue], 10, 64)
+	if err != nil {
+		return lineValues{ip: ip}, ReasonBadMysteryValue
+	}
+
+	lat, err := strconv.ParseFloat(record[cols.latitude], 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return lineValues{ip: ip}, ReasonBadLatitude
+	}
+
+	lon, err := strconv.ParseFloat(record[cols.longitude], 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return lineValues{ip: ip}, ReasonBadLongitude
+	}
+
+	return lineValues{
+		ip:           ip,
+		countryCode:  record[cols.countryCode],
+		countryName:  record[cols.country],
+		cityName:     record[cols.city],
+		latitude:     lat,
+		longitude:    lon,
+		mysteryValue: mysteryValue,
+	}, ""
+}
+
+// worker - worker function to parse csv file and import to the database. Once
+// the context is cancelled, the remaining tasks and the batch are dropped.
+func (c *Core) worker(ctx context.Context, wg *sync.WaitGroup, cols columns, tasks chan task) error {
 	defer wg.Done()
 
 	// =========================================================================
 	// init cores
-	countryCoreInst := countryCore.NewCore(c.log, c.db, nil)
-	cityCoreInst := cityCore.NewCore(c.log, c.db, nil)
-	locationCoreInst := locationCore.NewCore(c.log, c.db, nil)
+	countryCoreInst := countryCore.NewCore(c.log, c.staging, nil)
+	cityCoreInst := cityCore.NewCore(c.log, c.staging, nil)
+	locationCoreInst := locationCore.NewCore(c.log, c.staging, nil)
 
 	// =========================================================================
 	// prepare caches for countries and cities to avoid unnecessary calls to db
 	countryCache := make(map[string]string)
 	cityCache := make(map[string]string)
 
-	for task := range tasks {
-		now := time.Now()
-		ctx := context.Background()
-
-		// =========================================================================
-		// creating vars from csv line for next usage
-		// this code looks repetitive but it allows to avoid
-		// unclean indexes, like record[2]. It might lead to
-		// hardly detected errors
-		ipIdx, err := getRecordValue("ip_address")
-		if err != nil {
-			c.failed.Inc()
-			continue
-		}
-		ip := task[ipIdx]
+	b := newBatch(c.batchSize)
 
-		codeIdx, err := getRecordValue("country_code")
-		if err != nil {
-			c.failed.Inc()
-			continue
-		}
-		countryCode := task[codeIdx]
+	for t := range tasks {
+		now := time.Now()
 
-		countryIdx, err := getRecordValue("country")
-		if err != nil {
-			c.failed.Inc()
+		if ctx.Err() != nil {
+			if t.barrier != nil {
+				t.barrier.Done()
+			}
 			continue
 		}
-		countryName := task[countryIdx]
 
-		cityIdx, err := getRecordValue("city")
-		if err != nil {
-			c.failed.Inc()
+		if t.barrier != nil {
+			c.flush(ctx, b, now, cityCoreInst, locationCoreInst, countryCache, cityCache)
+			t.barrier.Done()
 			continue
 		}
-		cityName := task[cityIdx]
+		line, record := t.line, t.record
 
-		latIdx, err := getRecordValue("latitude")
-		if err != nil {
-			c.failed.Inc()
-			continue
-		}
-		latStr := task[latIdx]
+		// =========================================================================
+		// prepare values for creating new location, so broken lines
+		// don't create countries and cities
+		values, reason := parseLine(cols, record)
 
-		lonIdx, err := getRecordValue("longitude")
-		if err != nil {
-			c.failed.Inc()
-			continue
+		// every ip of the file counts as seen, even if its line fails, so
+		// a broken line doesn't delete the location
+		if c.deleteMissing && values.ip != "" {
+			b.seen = append(b.seen, values.ip)
 		}
-		lonStr := task[lonIdx]
 
-		mysteryIdx, err := getRecordValue("mystery_value")
-		if err != nil {
-			c.failed.Inc()
+		if reason != "" {
+			c.reject(line, record, reason)
 			continue
 		}
-		mysteryValueStr := task[mysteryIdx]
+		countryCode := values.countryCode
 
 		// =========================================================================
 		// try ti get country uuid from cache
@@ -124,31 +348,33 @@ func (c *Core) worker(wg *sync.WaitGroup, tasks chan []string) error {
 		if !ok {
 			// create new country
 			createdCountry, err := countryCoreInst.Create(ctx, countryCore.NewCountry{
-				Name: countryName,
+				Name: values.countryName,
 				Code: countryCode,
 			}, now)
 
 			if errors.Is(err, countryCore.ErrValidation) {
-				c.failed.Inc()
+				c.reject(line, record, ReasonValidation)
 				continue
 			}
 
 			if errors.Is(err, countryCore.ErrDuplicate) {
-				err = c.loadCaches(countryCode, countryCache, cityCache)
+				err = c.loadCaches(ctx, countryCode, countryCache, cityCache)
 				if err != nil {
-					c.failed.Inc()
+					c.reject(line, record, ReasonDBError)
 					continue
 				}
 
 				countryUUID, ok = countryCache[countryCode]
 				if !ok {
-					c.failed.Inc()
+					c.reject(line, record, ReasonDBError)
 					continue
 				}
 			}
 
 			if err != nil {
-				c.failed.Inc()
+				if ctx.Err() == nil {
+					c.reject(line, record, ReasonDBError)
+				}
 				continue
 			}
 
@@ -160,88 +386,488 @@ func (c *Core) worker(wg *sync.WaitGroup, tasks chan []string) error {
 			}
 		}
 
-		// try ti get city uuid from cache
-		cityUUID := cityCache[cityName+"#"+countryUUID]
-		if cityUUID == "" {
-			// create new city
-			createdCity, err := cityCoreInst.Create(ctx, cityCore.NewCity{
-				CountryUUID: countryUUID,
-				Name:        cityName,
-			}, now)
-
-			if errors.Is(err, cityCore.ErrValidation) {
-				c.failed.Inc()
-				continue
+		// unknown cities are created together with the batch of locations
+		cityKey := values.cityName + "#" + countryUUID
+		if _, ok := cityCache[cityKey]; !ok {
+			if _, ok := b.cityKeys[cityKey]; !ok {
+				b.cityKeys[cityKey] = struct{}{}
+				b.cities = append(b.cities, pendingCity{
+					countryCode: countryCode,
+					city: cityCore.NewCity{
+						CountryUUID: countryUUID,
+						Name:        values.cityName,
+					},
+				})
 			}
+		}
 
-			if err != nil {
-				c.failed.Inc()
-				continue
+		b.locations = append(b.locations, pendingLocation{
+			line:    line,
+			record:  record,
+			cityKey: cityKey,
+			location: locationCore.NewLocation{
+				IP:           values.ip,
+				Longitude:    values.longitude,
+				Latitude:     values.latitude,
+				MysteryValue: values.mysteryValue,
+			},
+		})
+
+		if len(b.locations) >= c.batchSize || len(b.seen) >= maxBatchSize {
+			c.flush(ctx, b, now, cityCoreInst, locationCoreInst, countryCache, cityCache)
+		}
+	}
+
+	if ctx.Err() == nil {
+		c.flush(ctx, b, time.Now(), cityCoreInst, locationCoreInst, countryCache, cityCache)
+	}
+
+	return nil
+}
+
+// flush writes the buffered cities and locations of a batch to the database.
+// Every batch is tried with a single multi-row insert first. If the database
+// rejects it, the records are inserted one by one so each csv line is
+// accounted as good or failed on its own.
+func (c *Core) flush(ctx context.Context, b *batch, now time.Time, cityCoreInst cityCore.Core, locationCoreInst locationCore.Core, countryCache, cityCache map[string]string) {
+	defer b.reset()
+
+	if c.deleteMissing {
+		if err := locationCoreInst.MarkSeen(ctx, b.seen); err != nil {
+			c.log.Errorw("marking seen ips", "ERROR", err)
+			c.seenFailed.Store(true)
+		}
+	}
+
+	// =========================================================================
+	// create cities first as locations reference them, reasons of failed
+	// cities are kept to reject lines referencing them
+	cityFailures := make(map[string]string)
+	if len(b.cities) > 0 {
+		newCities := make([]cityCore.NewCity, len(b.cities))
+		for i, pending := range b.cities {
+			newCities[i] = pending.city
+		}
+
+		createdCities, err := cityCoreInst.CreateBatch(ctx, newCities, now)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			for _, city := range createdCities {
+				cityCache[city.Name+"#"+city.CountryUUID] = city.UUID
 			}
+		} else {
+			for _, pending := range b.cities {
+				cityKey := pending.city.Name + "#" + pending.city.CountryUUID
 
-			//update city cache if we successfully created  city
-			if createdCity.UUID != "" {
-				cityUUID = createdCity.UUID
-				cityCache[cityName+"#"+countryUUID] = cityUUID
+				createdCity, err := cityCoreInst.Create(ctx, pending.city, now)
+				if errors.Is(err, cityCore.ErrDuplicate) {
+					// city was created outside of this worker, so refresh caches
+					if err := c.loadCaches(ctx, pending.countryCode, countryCache, cityCache); err != nil {
+						c.log.Errorw("loading caches", "country_code", pending.countryCode, "ERROR", err)
+						cityFailures[cityKey] = ReasonDBError
+					}
+					continue
+				}
+
+				if errors.Is(err, cityCore.ErrValidation) {
+					cityFailures[cityKey] = ReasonValidation
+					continue
+				}
+
+				if err != nil {
+					cityFailures[cityKey] = ReasonDBError
+					continue
+				}
+
+				cityCache[createdCity.Name+"#"+createdCity.CountryUUID] = createdCity.UUID
 			}
 		}
-		// prepare values for creating new location
-		mysteryValue, err := strconv.ParseInt(mysteryValueStr, 10, 64)
-		if err != nil {
-			c.failed.Inc()
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// =========================================================================
+	// create locations, lines with a failed city are failed as well
+	pendings := make([]pendingLocation, 0, len(b.locations))
+	newLocations := make([]locationCore.NewLocation, 0, len(b.locations))
+	for _, pending := range b.locations {
+		cityUUID, ok := cityCache[pending.cityKey]
+		if !ok {
+			reason, ok := cityFailures[pending.cityKey]
+			if !ok {
+				reason = ReasonDBError
+			}
+			c.reject(pending.line, pending.record, reason)
 			continue
 		}
 
-		lat, err := strconv.ParseFloat(latStr, 64)
-		if err != nil {
-			c.failed.Inc()
-			continue
+		pending.location.CityUUID = cityUUID
+		pendings = append(pendings, pending)
+		newLocations = append(newLocations, pending.location)
+	}
+
+	if len(newLocations) == 0 {
+		return
+	}
+
+	if c.delta {
+		c.upsert(ctx, pendings, now, locationCoreInst)
+		return
+	}
+
+	if _, err := locationCoreInst.CreateBatch(ctx, newLocations, now); err == nil {
+		c.good.Add(int32(len(newLocations)))
+		c.inserted.Add(int32(len(newLocations)))
+		return
+	}
+
+	// lines of an interrupted import are neither good nor failed
+	if ctx.Err() != nil {
+		return
+	}
+
+	var replays []pendingLocation
+	for _, pending := range pendings {
+		_, err := locationCoreInst.Create(ctx, pending.location, now)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, locationCore.ErrValidation):
+			c.reject(pending.line, pending.record, ReasonValidation)
+		case errors.Is(err, locationCore.ErrDuplicate) && pending.line <= c.replayUntil:
+			replays = append(replays, pending)
+		case errors.Is(err, locationCore.ErrDuplicate):
+			c.reject(pending.line, pending.record, ReasonDuplicateIP)
+		case err != nil:
+			c.reject(pending.line, pending.record, ReasonDBError)
+		default:
+			c.good.Inc()
+			c.inserted.Inc()
 		}
+	}
 
-		lon, err := strconv.ParseFloat(lonStr, 64)
-		if err != nil {
-			c.failed.Inc()
-			continue
+	c.replay(ctx, replays, locationCoreInst)
+}
+
+// replay accounts duplicated lines of a resumed run which might have been
+// written after the last checkpoint before the run was interrupted. A location
+// stored with the same values is the line itself, anything else is a duplicated
+// ip.
+func (c *Core) replay(ctx context.Context, pendings []pendingLocation, locationCoreInst locationCore.Core) {
+	if len(pendings) == 0 {
+		return
+	}
+
+	ips := make([]string, len(pendings))
+	for i, pending := range pendings {
+		ips[i] = pending.location.IP
+	}
+
+	existing, err := locationCoreInst.QueryManyByIP(ctx, ips)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		c.log.Errorw("querying replayed locations", "ERROR", err)
+		for _, pending := range pendings {
+			c.reject(pending.line, pending.record, ReasonDBError)
 		}
+		return
+	}
 
-		// create new location task
-		_, err = locationCoreInst.Create(ctx, locationCore.NewLocation{
-			IP:           ip,
-			Longitude:    lon,
-			Latitude:     lat,
-			MysteryValue: mysteryValue,
-			CityUUID:     cityUUID,
-		}, now)
+	stored := make(map[string]locationCore.NewLocation, len(existing))
+	for _, location := range existing {
+		stored[location.IP] = locationCore.NewLocation{
+			IP:           location.IP,
+			Longitude:    location.Longitude,
+			Latitude:     location.Latitude,
+			MysteryValue: location.MysteryValue,
+			CityUUID:     location.CityUUID,
+		}
+	}
 
-		if errors.Is(err, locationCore.ErrValidation) {
-			c.failed.Inc()
+	// a location stands for one line only, the same line given twice is still
+	// a duplicate
+	for _, pending := range pendings {
+		location, ok := stored[pending.location.IP]
+		if !ok || location != pending.location {
+			c.reject(pending.line, pending.record, ReasonDuplicateIP)
 			continue
 		}
 
-		if err != nil {
-			c.failed.Inc()
+		delete(stored, pending.location.IP)
+		c.good.Inc()
+		c.inserted.Inc()
+	}
+}
+
+// upsert writes the pending locations of a delta import. Every location is
+// compared with the record of the same ip: missing ones are inserted, changed
+// ones are updated and the rest is left untouched.
+func (c *Core) upsert(ctx context.Context, pendings []pendingLocation, now time.Time, locationCoreInst locationCore.Core) {
+	ips := make([]string, len(pendings))
+	for i, pending := range pendings {
+		ips[i] = pending.location.IP
+	}
+
+	existing, err := locationCoreInst.QueryManyByIP(ctx, ips)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		c.log.Errorw("querying existing locations", "ERROR", err)
+		for _, pending := range pendings {
+			c.reject(pending.line, pending.record, ReasonDBError)
+		}
+		return
+	}
+
+	current := make(map[string]locationCore.NewLocation, len(existing))
+	for _, location := range existing {
+		current[location.IP] = locationCore.NewLocation{
+			IP:           location.IP,
+			Longitude:    location.Longitude,
+			Latitude:     location.Latitude,
+			MysteryValue: location.MysteryValue,
+			CityUUID:     location.CityUUID,
+		}
+	}
+
+	// a later line with the same ip updates the location of an earlier one
+	writes := make([]pendingLocation, 0, len(pendings))
+	updates := make([]bool, 0, len(pendings))
+	for _, pending := range pendings {
+		location, ok := current[pending.location.IP]
+		if ok && location == pending.location {
+			c.good.Inc()
+			c.unchanged.Inc()
 			continue
 		}
 
-		c.good.Inc()
+		current[pending.location.IP] = pending.location
+		writes = append(writes, pending)
+		updates = append(updates, ok)
 	}
 
-	return nil
+	if len(writes) == 0 {
+		return
+	}
+
+	newLocations := make([]locationCore.NewLocation, len(writes))
+	for i, pending := range writes {
+		newLocations[i] = pending.location
+	}
+
+	if err := locationCoreInst.UpsertBatch(ctx, newLocations, now); err == nil {
+		for _, update := range updates {
+			c.upserted(update)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	for i, pending := range writes {
+		err := locationCoreInst.UpsertBatch(ctx, newLocations[i:i+1], now)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, locationCore.ErrValidation):
+			c.reject(pending.line, pending.record, ReasonValidation)
+		case err != nil:
+			c.reject(pending.line, pending.record, ReasonDBError)
+		default:
+			c.upserted(updates[i])
+		}
+	}
+}
+
+// upserted accounts a line written by a delta import.
+func (c *Core) upserted(update bool) {
+	c.good.Inc()
+	if update {
+		c.updated.Inc()
+		return
+	}
+	c.inserted.Inc()
+}
+
+// Source describes a csv file to import.
+type Source struct {
+	Name     string    // Name of the file, it is recorded with the run.
+	Checksum string    // Checksum of the file content, resume requires it to match.
+	Reader   io.Reader // Content of the file.
+
+	// Sum returns the checksum of a file whose checksum isn't known upfront,
+	// it is called once the run ends and recorded with it. An interrupted run
+	// must stop quickly, so it gets no checksum.
+	Sum func() (string, error)
 }
 
-// Import - import csv file to the database
-func (c *Core) Import(ctx context.Context, f io.Reader, workersCount int) (Statistic, error) {
+// Progress returns the counters of the running or the last import, it may be
+// called while the import runs.
+func (c *Core) Progress() Progress {
+	return Progress{
+		Lines:     int(c.lines.Load()),
+		Good:      int(c.good.Load()),
+		Failed:    int(c.failed.Load()),
+		Inserted:  int(c.inserted.Load()),
+		Updated:   int(c.updated.Load()),
+		Unchanged: int(c.unchanged.Load()),
+	}
+}
+
+// Import - import csv file to the database. The file is loaded into empty
+// staging tables which replace the live ones only if the whole file was read.
+func (c *Core) Import(ctx context.Context, src Source, workersCount int) (Statistic, error) {
+	if c.dryRun {
+		return c.validateFile(ctx, src)
+	}
+
+	stage := generation.Stage
+	if c.delta {
+		stage = generation.StageCopy
+	}
+	gen, err := stage(ctx, c.db, time.Now())
+	if err != nil {
+		return Statistic{}, err
+	}
+	c.replayUntil = 0
+
+	if c.deleteMissing {
+		if err := locationCore.NewCore(c.log, c.staging, nil).ResetSeen(ctx); err != nil {
+			return Statistic{}, err
+		}
+	}
+
+	run, err := c.runs.Create(ctx, importrun.NewRun{
+		FileName:     src.Name,
+		Checksum:     src.Checksum,
+		GenerationID: gen.ID,
+	}, time.Now())
+	if err != nil {
+		return Statistic{}, fmt.Errorf("starting run: %w", err)
+	}
+	c.log.Infow("start run", "run", run.UUID, "file", run.FileName)
+
+	return c.importRun(ctx, src, run, workersCount)
+}
+
+// Resume continues the latest run from its last checkpoint if the run was
+// interrupted while importing the same file and its staging tables weren't
+// replaced since. Otherwise the file is imported from the beginning, as well as
+// when locations missing from the file are deleted.
+func (c *Core) Resume(ctx context.Context, src Source, workersCount int) (Statistic, error) {
+	// ips of the lines before the checkpoint might not have been marked as
+	// seen, the locations of such ips would be deleted
+	if c.deleteMissing {
+		c.log.Infow("deleting missing locations, importing from the beginning", "file", src.Name)
+		return c.Import(ctx, src, workersCount)
+	}
+
+	run, err := c.runs.QueryLatest(ctx)
+	if err != nil && !errors.Is(err, importrun.ErrNotFound) {
+		return Statistic{}, fmt.Errorf("querying latest run: %w", err)
+	}
+
+	// a failed run may have read the whole file or failed to promote it, only
+	// an interrupted one stopped in the middle on purpose
+	if errors.Is(err, importrun.ErrNotFound) ||
+		run.Status != importrun.StatusInterrupted ||
+		src.Checksum == "" ||
+		run.Checksum != src.Checksum {
+		c.log.Infow("nothing to resume, importing from the beginning", "file", src.Name)
+		return c.Import(ctx, src, workersCount)
+	}
+
+	// a rollback moves other tables into the staging schema, a promote moves
+	// them away
+	staged, err := generation.QueryStaged(ctx, c.db)
+	if err != nil && !errors.Is(err, generation.ErrNotFound) {
+		return Statistic{}, fmt.Errorf("querying staged generation: %w", err)
+	}
+	if errors.Is(err, generation.ErrNotFound) || staged.ID != run.GenerationID {
+		c.log.Infow("staging tables replaced, importing from the beginning", "run", run.UUID, "file", src.Name)
+		return c.Import(ctx, src, workersCount)
+	}
+
+	c.log.Infow("resume run", "run", run.UUID, "file", run.FileName, "line", run.Line)
+
+	// workers might have written lines up to the next checkpoint before the
+	// run was interrupted, such lines are found in the staging tables again
+	c.replayUntil = run.Line + c.checkpointEvery
+
+	run, err = c.runs.Restart(ctx, run, time.Now())
+	if err != nil {
+		return Statistic{}, fmt.Errorf("restarting run: %w", err)
+	}
+
+	return c.importRun(ctx, src, run, workersCount)
+}
+
+// importRun reads the file skipping lines committed by the run before and
+// passes the rest to workers. Every checkpointEvery lines the workers flush
+// their batches and the reached line is stored as the checkpoint of the run.
+func (c *Core) importRun(ctx context.Context, src Source, run importrun.Run, workersCount int) (Statistic, error) {
 	// prepare csv-reader
-	csvReader := csv.NewReader(f)
-	isFirstLine := true
+	csvReader := c.mapping.newReader(src.Reader)
 
 	st := Statistic{}
 	start := time.Now()
 
+	// counters are kept on the core, so continue them from the checkpoint
+	c.lines.Store(0)
+	c.good.Store(int32(run.GoodLines))
+	c.failed.Store(int32(run.FailedLines))
+	c.inserted.Store(0)
+	c.updated.Store(0)
+	c.unchanged.Store(0)
+	c.seenFailed.Store(false)
+	c.rejects.reset()
+
+	// fail marks the run as failed keeping its last checkpoint. The status is
+	// recorded even if the context is cancelled.
+	fail := func(st Statistic, err error) (Statistic, error) {
+		if ferr := c.rejects.flush(); ferr != nil {
+			c.log.Errorw("writing rejects", "ERROR", ferr)
+		}
+
+		status := importrun.StatusFailed
+		if errors.Is(err, ErrInterrupted) {
+			status = importrun.StatusInterrupted
+		}
+		c.finish(context.Background(), run, src, st, status, err)
+		return st, err
+	}
+
+	// =========================================================================
+	// find columns of the fields by the header line
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return fail(Statistic{}, ErrNotValidFormat)
+	}
+	if err != nil {
+		return fail(Statistic{}, err)
+	}
+	st.TotalLines += 1
+	c.lines.Inc()
+
+	cols, err := c.mapping.detectColumns(header)
+	if err != nil {
+		return fail(Statistic{}, err)
+	}
+	c.rejects.header(header)
+
 	// create task chan
-	tasks := make([]chan []string, workersCount)
+	tasks := make([]chan task, workersCount)
 	for idx, _ := range tasks {
-		tasks[idx] = make(chan []string, taskChanSize)
+		tasks[idx] = make(chan task, taskChanSize)
 	}
 
 	// worker usage array
@@ -255,17 +881,43 @@ func (c *Core) Import(ctx context.Context, f io.Reader, workersCount int) (Stati
 
 	c.log.Infow("start workers", "count", workersCount)
 	for i := 0; i < workersCount; i++ {
-		go c.worker(&wg, tasks[i])
+		go c.worker(ctx, &wg, cols, tasks[i])
 	}
 
-	for {
+	// stopWorkers lets workers flush what they have and waits for them
+	stopWorkers := func() {
+		for _, ch := range tasks {
+			close(ch)
+		}
+		wg.Wait()
+	}
+
+	// checkpoint waits until workers flush everything sent so far and
+	// stores the line as committed
+	checkpoint := func(line int) {
+		var barrier sync.WaitGroup
+		barrier.Add(workersCount)
+		for _, ch := range tasks {
+			ch <- task{barrier: &barrier}
+		}
+		barrier.Wait()
+
+		// workers drop their tasks once the import is interrupted
+		if ctx.Err() != nil {
+			return
+		}
+		c.saveCheckpoint(ctx, &run, line)
+	}
+
+	for ctx.Err() == nil {
 		record, err := csvReader.Read()
 		if err == io.EOF {
 			break
 		}
 
 		if err != nil {
-			return Statistic{}, err
+			stopWorkers()
+			return fail(Statistic{}, err)
 		}
 
 		if len(record) == 0 {
@@ -273,29 +925,17 @@ func (c *Core) Import(ctx context.Context, f io.Reader, workersCount int) (Stati
 		}
 
 		st.TotalLines += 1
+		c.lines.Inc()
 
-		if isFirstLine {
-			// check if field names are equal to which are they considered
-			if !checkFileFormat(record) {
-				return Statistic{}, ErrNotValidFormat
-			}
-
-			isFirstLine = false
-
-			// pre-warm headersReverseMap
-			// there is used map without mutex so there will be a problem
-			// in case of simultaneously write by multiple go-routines
-			// so run write to map operation before any of the go-routines started
-			// this is the only write operation in headersReverseMap
-			_, _ = getRecordValue("ip_address")
+		// the line was committed by the run before it was interrupted
+		if st.TotalLines <= run.Line {
 			continue
 		}
 
-		idx, _ := getRecordValue("country_code")
-		str := record[idx]
+		str := record[cols.countryCode]
 
 		if taskChanIdx, ok := countryToWorker[str]; ok {
-			tasks[taskChanIdx] <- record
+			tasks[taskChanIdx] <- task{line: st.TotalLines, record: record}
 		} else {
 			var taskChanIdx int
 			for idx, row := range usage {
@@ -306,32 +946,123 @@ func (c *Core) Import(ctx context.Context, f io.Reader, workersCount int) (Stati
 
 			usage[taskChanIdx] += 1
 			countryToWorker[str] = taskChanIdx
-			tasks[taskChanIdx] <- record
+			tasks[taskChanIdx] <- task{line: st.TotalLines, record: record}
 		}
 
 		if st.TotalLines%10000 == 0 {
 			c.log.Infow("processed", "lines", st.TotalLines)
 		}
-	}
 
-	for _, task := range tasks {
-		close(task)
+		if st.TotalLines%c.checkpointEvery == 0 {
+			checkpoint(st.TotalLines)
+		}
 	}
-	wg.Wait()
+
+	stopWorkers()
 
 	st.GoodLines = int(c.good.Load())
 	st.FailedLines = int(c.failed.Load())
+	st.FailureReasons = c.rejects.counts()
+	st.Inserted = int(c.inserted.Load())
+	st.Updated = int(c.updated.Load())
+	st.Unchanged = int(c.unchanged.Load())
+
+	// the run keeps the checkpoint before the interruption, so it can be
+	// resumed from there
+	if ctx.Err() != nil {
+		st.Duration = time.Since(start)
+		return fail(st, fmt.Errorf("%w: %s", ErrInterrupted, ctx.Err()))
+	}
+
+	if err := c.rejects.flush(); err != nil {
+		c.log.Errorw("writing rejects", "ERROR", err)
+	}
+
+	// without every ip of the file recorded, present locations would be deleted
+	if c.deleteMissing {
+		if c.seenFailed.Load() {
+			return fail(st, ErrSeenIncomplete)
+		}
+
+		deleted, err := locationCore.NewCore(c.log, c.staging, nil).DeleteUnseen(ctx)
+		if err != nil {
+			return fail(st, err)
+		}
+		st.Deleted = deleted
+	}
+
+	// the whole file is in the staging tables only once missing locations are
+	// deleted
+	c.saveCheckpoint(ctx, &run, st.TotalLines)
+
+	// never replace the live dataset with an empty one
+	if st.GoodLines == 0 {
+		return fail(st, ErrNothingImported)
+	}
+
+	gen, err := generation.Promote(ctx, c.db, time.Now())
+	if err != nil {
+		return fail(st, err)
+	}
+	c.log.Infow("promoted", "generation", gen.ID)
 
 	st.Duration = time.Since(start)
+	c.finish(ctx, run, src, st, importrun.StatusFinished, nil)
+
 	return st, nil
 }
 
+// finish records the result of the run together with the checksum of the file
+// if the source calculates it while being imported. The rest of the file isn't
+// hashed for an interrupted run, it may be too big to finish before the process
+// is killed.
+func (c *Core) finish(ctx context.Context, run importrun.Run, src Source, st Statistic, status string, err error) {
+	res := importrun.Result{
+		Status:     status,
+		TotalLines: st.TotalLines,
+		Inserted:   st.Inserted,
+		Updated:    st.Updated,
+		Unchanged:  st.Unchanged,
+		Deleted:    st.Deleted,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	if src.Sum != nil && status != importrun.StatusInterrupted {
+		sum, err := src.Sum()
+		if err != nil {
+			c.log.Errorw("calculating checksum", "run", run.UUID, "ERROR", err)
+		}
+		res.Checksum = sum
+	}
+
+	if _, err := c.runs.Finish(ctx, run, res, time.Now()); err != nil {
+		c.log.Errorw("finishing run", "run", run.UUID, "ERROR", err)
+	}
+}
+
+// saveCheckpoint stores the line and the counters as the progress of the run.
+// Workers must have flushed all lines up to the given one.
+func (c *Core) saveCheckpoint(ctx context.Context, run *importrun.Run, line int) {
+	updated, err := c.runs.UpdateCheckpoint(ctx, *run, importrun.Checkpoint{
+		Line:        line,
+		GoodLines:   int(c.good.Load()),
+		FailedLines: int(c.failed.Load()),
+	}, time.Now())
+	if err != nil {
+		c.log.Errorw("saving checkpoint", "run", run.UUID, "line", line, "ERROR", err)
+		return
+	}
+
+	*run = updated
+}
+
 // loadCaches - load country and all related cities
-func (c *Core) loadCaches(countryCode string, countryCache, cityCache map[string]string) error {
-	countryCoreInst := countryCore.NewCore(c.log, c.db, nil)
-	cityCoreInst := cityCore.NewCore(c.log, c.db, nil)
+func (c *Core) loadCaches(ctx context.Context, countryCode string, countryCache, cityCache map[string]string) error {
+	countryCoreInst := countryCore.NewCore(c.log, c.staging, nil)
+	cityCoreInst := cityCore.NewCore(c.log, c.staging, nil)
 
-	ctx := context.Background()
 	country, err := countryCoreInst.QueryByCode(ctx, countryCode)
 	if err != nil {
 		return err
@@ -3,13 +3,20 @@ package importer_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"github.com/google/go-cmp/cmp"
 	cityCore "github.com/mchusovlianov/geodata/business/core/city"
 	countryCore "github.com/mchusovlianov/geodata/business/core/country"
 	"github.com/mchusovlianov/geodata/business/core/importer"
 	locationCore "github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/generation"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/business/data/tests"
 	"github.com/mchusovlianov/geodata/foundation/docker"
+	"go.uber.org/zap"
+	"io"
 	"testing"
+	"time"
 )
 
 var c *docker.Container
@@ -30,7 +37,7 @@ func Test_Importer(t *testing.T) {
 	)
 	t.Cleanup(test.Teardown)
 
-	core, err := importer.NewCore(test.Log, test.DB)
+	core, err := importer.NewCore(test.Log, test.DB, test.StagingDB)
 	if err != nil {
 		t.Fatalf("Can't create an importer core %s", err)
 	}
@@ -47,7 +54,7 @@ LI,Guyana,Port Karson,-78.2274228596799,-163.26218895343357,1337885276`)
 			bytesReader := bytes.NewReader(b)
 
 			ctx := context.Background()
-			_, err := core.Import(ctx, bytesReader, 2)
+			_, err := core.Import(ctx, importer.Source{Name: "test.csv", Reader: bytesReader}, 2)
 			if err == nil {
 				t.Fatalf("\t%s\tTest %d:\tShould not be able to import file in the wrong format.", tests.Failed, testID)
 			}
@@ -66,7 +73,7 @@ LI,Guyana,Port Karson,-78.2274228596799,-163.26218895343357,1337885276`)
 			bytesReader := bytes.NewReader(b)
 
 			ctx := context.Background()
-			stat, err := core.Import(ctx, bytesReader, 2)
+			stat, err := core.Import(ctx, importer.Source{Name: "test.csv", Reader: bytesReader}, 2)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to import a good file without error %s.", tests.Failed, testID, err)
 			}
@@ -76,24 +83,411 @@ LI,Guyana,Port Karson,-78.2274228596799,-163.26218895343357,1337885276`)
 			}
 
 			countryCoreInst := countryCore.NewCore(test.Log, test.DB, nil)
-			countries, err := countryCoreInst.QueryAll(ctx)
-			if len(countries) != 2 {
-				t.Fatalf("\t%s\tTest %d:\tShould be created 2 countries during import, got - %v.", tests.Failed, testID, len(countries))
+			countries, err := countryCoreInst.Query(ctx, page.Query{Sort: "name", Limit: 10})
+			if countries.Total != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould be created 2 countries during import, got - %v.", tests.Failed, testID, countries.Total)
 			}
 
 			cityCoreInst := cityCore.NewCore(test.Log, test.DB, nil)
-			cities, err := cityCoreInst.QueryAll(ctx)
-			if len(cities) != 3 {
-				t.Fatalf("\t%s\tTest %d:\tShould be created 3 cities during import, got - %v.", tests.Failed, testID, len(cities))
+			cities, err := cityCoreInst.Query(ctx, page.Query{Sort: "name", Limit: 10})
+			if cities.Total != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould be created 3 cities during import, got - %v.", tests.Failed, testID, cities.Total)
 			}
 
 			locationCoreInst := locationCore.NewCore(test.Log, test.DB, nil)
 			locations, err := locationCoreInst.QueryAll(ctx)
 			if len(locations) != 3 {
-				t.Fatalf("\t%s\tTest %d:\tShould be created 3 locations during import, got - %v.", tests.Failed, testID, len(cities))
+				t.Fatalf("\t%s\tTest %d:\tShould be created 3 locations during import, got - %v.", tests.Failed, testID, len(locations))
 			}
 
 			t.Logf("\t%s\tTest %d:\tShould be able to import a good file without error.", tests.Success, testID)
 		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen import file with a record rejected inside a batch.", testID)
+		{
+			var rejected bytes.Buffer
+			batchCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithBatchSize(2), importer.WithRejects(&rejected))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core with batch size: %s.", tests.Failed, testID, err)
+			}
+
+			b := []byte(`ip_address,country_code,country,city,latitude,longitude,mystery_value
+200.106.141.17,SI,Nepal,TestCity3,-84.87503094689836,7.206435933364332,7823011346
+200.106.141.17,SI,Nepal,TestCity3,-84.87503094689831,7.206435933364332,7823011346
+200.106.141.18,SI,Nepal,TestCity3,-84.87503094689831,7.206435933364332,7823011346`)
+
+			bytesReader := bytes.NewReader(b)
+
+			ctx := context.Background()
+			stat, err := batchCore.Import(ctx, importer.Source{Name: "batch.csv", Reader: bytesReader}, 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to import a file without error %s.", tests.Failed, testID, err)
+			}
+
+			if stat.GoodLines != 2 || stat.FailedLines != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould account every line of a rejected batch. Got good - %v, failed - %v. Expected - 2 and 1.", tests.Failed, testID, stat.GoodLines, stat.FailedLines)
+			}
+
+			t.Logf("\t%s\tTest %d:\tShould account every line of a rejected batch.", tests.Success, testID)
+
+			if stat.FailureReasons[importer.ReasonDuplicateIP] != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the failed line as a duplicate: %v.", tests.Failed, testID, stat.FailureReasons)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the failed line as a duplicate.", tests.Success, testID)
+
+			exp := `ip_address,country_code,country,city,latitude,longitude,mystery_value,line,reason
+200.106.141.17,SI,Nepal,TestCity3,-84.87503094689831,7.206435933364332,7823011346,3,duplicate_ip
+`
+			if diff := cmp.Diff(exp, rejected.String()); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould write the failed line to rejects. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write the failed line to rejects.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen rolling back to the previous generation.", testID)
+		{
+			ctx := context.Background()
+
+			locationCoreInst := locationCore.NewCore(test.Log, test.DB, nil)
+			locations, err := locationCoreInst.QueryAll(ctx)
+			if err != nil || len(locations) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould serve only the last imported generation, got - %v: %v.", tests.Failed, testID, len(locations), err)
+			}
+
+			// a previous generation promoted before the generation id was kept
+			// with the tables lacks the table of the id
+			var schema string
+			if err := test.DB.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&schema); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the schema name: %s.", tests.Failed, testID, err)
+			}
+			if _, err := test.DB.ExecContext(ctx, "DROP TABLE `"+schema+generation.PreviousSuffix+"`.`dataset_generation`"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to drop the previous generation id: %s.", tests.Failed, testID, err)
+			}
+
+			gen, err := generation.Rollback(ctx, test.DB, time.Now())
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to roll back: %s.", tests.Failed, testID, err)
+			}
+
+			current, err := generation.QueryCurrent(ctx, test.DB)
+			if err != nil || current.ID != gen.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould make the rolled back generation current, got - %v: %v.", tests.Failed, testID, current.ID, err)
+			}
+
+			locations, err = locationCoreInst.QueryAll(ctx)
+			if err != nil || len(locations) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould serve the previous generation after rollback, got - %v: %v.", tests.Failed, testID, len(locations), err)
+			}
+
+			if _, err := generation.Rollback(ctx, test.DB, time.Now()); !errors.Is(err, generation.ErrNoPrevious) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to roll back twice: %v.", tests.Failed, testID, err)
+			}
+
+			t.Logf("\t%s\tTest %d:\tShould be able to roll back to the previous generation.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen resuming an import interrupted between a flush and a checkpoint.", testID)
+		{
+			var rejected bytes.Buffer
+			resumeCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithCheckpointEvery(3), importer.WithBatchSize(1), importer.WithRejects(&rejected))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core with checkpoints: %s.", tests.Failed, testID, err)
+			}
+
+			// the checkpoint is the line 3, the import is interrupted once the
+			// line 4 is written
+			head := `ip_address,country_code,country,city,latitude,longitude,mystery_value
+10.0.1.1,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.1.2,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.1.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+`
+			fixed := head + `10.0.1.4,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+10.0.1.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,42`
+
+			ctx, cancel := context.WithCancel(context.Background())
+			in := interruptingReader{
+				r:      bytes.NewReader([]byte(head)),
+				cancel: cancel,
+				wait:   func() bool { return resumeCore.Progress().Good == 3 },
+			}
+			_, err = resumeCore.Import(ctx, importer.Source{Name: "flushed.csv", Checksum: "flushed", Reader: &in}, 1)
+			if !errors.Is(err, importer.ErrInterrupted) {
+				t.Fatalf("\t%s\tTest %d:\tShould interrupt the import: %v.", tests.Failed, testID, err)
+			}
+			rejected.Reset()
+
+			ctx = context.Background()
+
+			stat, err := resumeCore.Resume(ctx, importer.Source{Name: "flushed.csv", Checksum: "flushed", Reader: bytes.NewReader([]byte(fixed))}, 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resume the import: %s.", tests.Failed, testID, err)
+			}
+
+			if stat.GoodLines != 4 || stat.FailedLines != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould account the lines written after the checkpoint as good. Got good - %v, failed - %v. Expected - 4 and 1.", tests.Failed, testID, stat.GoodLines, stat.FailedLines)
+			}
+			t.Logf("\t%s\tTest %d:\tShould account the lines written after the checkpoint as good.", tests.Success, testID)
+
+			exp := `ip_address,country_code,country,city,latitude,longitude,mystery_value,line,reason
+10.0.1.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,42,6,duplicate_ip
+`
+			if diff := cmp.Diff(exp, rejected.String()); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould still reject a duplicated ip. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still reject a duplicated ip.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen resuming an interrupted import.", testID)
+		{
+			resumeCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithCheckpointEvery(2))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core with checkpoints: %s.", tests.Failed, testID, err)
+			}
+
+			// the checkpoint is the line 4, the import is interrupted right
+			// after it
+			head := `ip_address,country_code,country,city,latitude,longitude,mystery_value
+10.0.0.1,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.0.2,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.0.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+`
+			fixed := head + `10.0.0.4,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115`
+
+			ctx, cancel := context.WithCancel(context.Background())
+			in := interruptingReader{r: bytes.NewReader([]byte(head)), cancel: cancel}
+			_, err = resumeCore.Import(ctx, importer.Source{Name: "resume.csv", Checksum: "resume", Reader: &in}, 2)
+			if !errors.Is(err, importer.ErrInterrupted) {
+				t.Fatalf("\t%s\tTest %d:\tShould interrupt the import: %v.", tests.Failed, testID, err)
+			}
+
+			ctx = context.Background()
+
+			stat, err := resumeCore.Resume(ctx, importer.Source{Name: "resume.csv", Checksum: "resume", Reader: bytes.NewReader([]byte(fixed))}, 2)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to resume the import: %s.", tests.Failed, testID, err)
+			}
+
+			if stat.GoodLines != 4 || stat.FailedLines != 0 || stat.Inserted != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould import every line once. Got good - %v, failed - %v, inserted - %v. Expected - 4, 0 and 1.", tests.Failed, testID, stat.GoodLines, stat.FailedLines, stat.Inserted)
+			}
+
+			t.Logf("\t%s\tTest %d:\tShould be able to resume an interrupted import.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen applying a delta file to the live records.", testID)
+		{
+			deltaCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithDelta(true))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core for delta imports: %s.", tests.Failed, testID, err)
+			}
+
+			ctx := context.Background()
+			locationCoreInst := locationCore.NewCore(test.Log, test.DB, nil)
+			before, err := locationCoreInst.QueryByIP(ctx, "10.0.0.2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to find the location to update: %s.", tests.Failed, testID, err)
+			}
+
+			b := []byte(`ip_address,country_code,country,city,latitude,longitude,mystery_value
+10.0.0.1,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.0.2,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,42
+10.0.0.5,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346`)
+
+			stat, err := deltaCore.Import(ctx, importer.Source{Name: "delta.csv", Reader: bytes.NewReader(b)}, 2)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to apply a delta file: %s.", tests.Failed, testID, err)
+			}
+
+			if stat.Inserted != 1 || stat.Updated != 1 || stat.Unchanged != 1 || stat.Deleted != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the changes. Got %+v.", tests.Failed, testID, stat)
+			}
+
+			after, err := locationCoreInst.QueryByIP(ctx, "10.0.0.2")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to find the updated location: %s.", tests.Failed, testID, err)
+			}
+
+			if after.UUID != before.UUID || after.MysteryValue != 42 {
+				t.Fatalf("\t%s\tTest %d:\tShould update the location in place. Got %+v.", tests.Failed, testID, after)
+			}
+
+			if _, err := locationCoreInst.QueryByIP(ctx, "10.0.0.3"); !errors.Is(err, locationCore.ErrNotFound) {
+				t.Fatalf("\t%s\tTest %d:\tShould delete locations absent from the file: %v.", tests.Failed, testID, err)
+			}
+
+			t.Logf("\t%s\tTest %d:\tShould be able to apply a delta file.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen resuming an import which can't be continued.", testID)
+		{
+			resumeCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithCheckpointEvery(2))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core with checkpoints: %s.", tests.Failed, testID, err)
+			}
+
+			head := `ip_address,country_code,country,city,latitude,longitude,mystery_value
+10.0.2.1,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.2.2,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.2.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+`
+			broken := head + `10.0.2.4,CZ,Nicaragua`
+			fixed := head + `10.0.2.4,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115`
+
+			ctx := context.Background()
+			_, err = resumeCore.Import(ctx, importer.Source{Name: "failed.csv", Checksum: "failed", Reader: bytes.NewReader([]byte(broken))}, 1)
+			if err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to import a broken file.", tests.Failed, testID)
+			}
+
+			// lines skipped on resume aren't counted as inserted
+			stat, err := resumeCore.Resume(ctx, importer.Source{Name: "failed.csv", Checksum: "failed", Reader: bytes.NewReader([]byte(fixed))}, 1)
+			if err != nil || stat.Inserted != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould import a failed file from the beginning. Got inserted - %v: %v.", tests.Failed, testID, stat.Inserted, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould import a failed file from the beginning.", tests.Success, testID)
+
+			ictx, cancel := context.WithCancel(ctx)
+			in := interruptingReader{r: bytes.NewReader([]byte(head)), cancel: cancel}
+			_, err = resumeCore.Import(ictx, importer.Source{Name: "replaced.csv", Checksum: "replaced", Reader: &in}, 1)
+			if !errors.Is(err, importer.ErrInterrupted) {
+				t.Fatalf("\t%s\tTest %d:\tShould interrupt the import: %v.", tests.Failed, testID, err)
+			}
+
+			// the rollback moves the live tables into the staging schema
+			if _, err := generation.Rollback(ctx, test.DB, time.Now()); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to roll back: %s.", tests.Failed, testID, err)
+			}
+
+			stat, err = resumeCore.Resume(ctx, importer.Source{Name: "replaced.csv", Checksum: "replaced", Reader: bytes.NewReader([]byte(fixed))}, 1)
+			if err != nil || stat.Inserted != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould import the file from the beginning once the staging tables were replaced. Got inserted - %v: %v.", tests.Failed, testID, stat.Inserted, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould import the file from the beginning once the staging tables were replaced.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen resuming a delta import deleting missing locations.", testID)
+		{
+			deltaCore, err := importer.NewCore(test.Log, test.DB, test.StagingDB, importer.WithDelta(true), importer.WithCheckpointEvery(2))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an importer core for delta imports: %s.", tests.Failed, testID, err)
+			}
+
+			// the live records are the ones of the file already
+			head := `ip_address,country_code,country,city,latitude,longitude,mystery_value
+10.0.2.1,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.2.2,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+10.0.2.3,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+`
+			fixed := head + `10.0.2.4,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115`
+
+			ctx, cancel := context.WithCancel(context.Background())
+			in := interruptingReader{r: bytes.NewReader([]byte(head)), cancel: cancel}
+			_, err = deltaCore.Import(ctx, importer.Source{Name: "missing.csv", Checksum: "missing", Reader: &in}, 1)
+			if !errors.Is(err, importer.ErrInterrupted) {
+				t.Fatalf("\t%s\tTest %d:\tShould interrupt the import: %v.", tests.Failed, testID, err)
+			}
+
+			ctx = context.Background()
+			stat, err := deltaCore.Resume(ctx, importer.Source{Name: "missing.csv", Checksum: "missing", Reader: bytes.NewReader([]byte(fixed))}, 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to import the file: %s.", tests.Failed, testID, err)
+			}
+
+			if stat.Unchanged != 4 || stat.Deleted != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould import the file from the beginning, deleting nothing. Got %+v.", tests.Failed, testID, stat)
+			}
+			t.Logf("\t%s\tTest %d:\tShould import the file from the beginning, deleting nothing.", tests.Success, testID)
+		}
+	}
+}
+
+// interruptingReader reads the content and cancels the import at its end, once
+// the optional wait function is satisfied.
+type interruptingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+	wait   func() bool
+}
+
+func (r *interruptingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		for deadline := time.Now().Add(5 * time.Second); r.wait != nil && !r.wait() && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		r.cancel()
+	}
+
+	return n, err
+}
+
+func Test_DryRun(t *testing.T) {
+	core, err := importer.NewCore(zap.NewNop().Sugar(), nil, nil, importer.WithDryRun())
+	if err != nil {
+		t.Fatalf("Can't create an importer core %s", err)
+	}
+
+	t.Log("Given the need to validate a file without importing it.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the file has good and broken lines.", testID)
+		{
+			b := []byte(`ip_address,country_code,country,city,latitude,longitude,mystery_value
+200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+200.106.141,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346
+160.103.7.140,C1,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115
+160.103.7.141,CZ,Nicaragua,New Neva,-98.31023296602508,-37.62435199624531,7301823115
+160.103.7.142,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,mystery
+160.103.7.143,CZ,Nicaragua,New Neva,-68.31023296602508,-37.62435199624531,7301823115`)
+
+			stat, err := core.Import(context.Background(), importer.Source{Name: "test.csv", Reader: bytes.NewReader(b)}, 2)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the file: %s.", tests.Failed, testID, err)
+			}
+
+			if stat.TotalLines != 8 || stat.GoodLines != 2 || stat.FailedLines != 5 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the lines. Got %+v.", tests.Failed, testID, stat)
+			}
+
+			if diff := cmp.Diff(importer.Progress{Lines: 8, Good: 2, Failed: 5}, core.Progress()); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould report the progress of the import. Diff:\n%s", tests.Failed, testID, diff)
+			}
+
+			exp := map[string]int{
+				importer.ReasonDuplicateIP:     1,
+				importer.ReasonBadIP:           1,
+				importer.ReasonValidation:      1,
+				importer.ReasonBadLatitude:     1,
+				importer.ReasonBadMysteryValue: 1,
+			}
+			if diff := cmp.Diff(exp, stat.FailureReasons); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould count failures by reason. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate the file.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen the context is cancelled.", testID)
+		{
+			b := []byte(`ip_address,country_code,country,city,latitude,longitude,mystery_value
+200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346`)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := core.Import(ctx, importer.Source{Name: "test.csv", Reader: bytes.NewReader(b)}, 2)
+			if !errors.Is(err, importer.ErrInterrupted) {
+				t.Fatalf("\t%s\tTest %d:\tShould stop with ErrInterrupted, got: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop with ErrInterrupted.", tests.Success, testID)
+		}
 	}
 }
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Set of reasons why a csv line failed to import.
+const (
+	ReasonBadIP           = "bad_ip"
+	ReasonBadLatitude     = "bad_latitude"
+	ReasonBadLongitude    = "bad_longitude"
+	ReasonBadMysteryValue = "bad_mystery_value"
+	ReasonValidation      = "validation"
+	ReasonDuplicateIP     = "duplicate_ip"
+	ReasonDBError         = "db_error"
+)
+
+// rejects counts failed lines by reason and writes them to the reject output
+// if it was requested. It is shared by all workers.
+type rejects struct {
+	mu      sync.Mutex
+	reasons map[string]int
+	w       *csv.Writer
+}
+
+func newRejects(w io.Writer) *rejects {
+	r := rejects{
+		reasons: make(map[string]int),
+	}
+	if w != nil {
+		r.w = csv.NewWriter(w)
+	}
+
+	return &r
+}
+
+// reset forgets reasons counted by a previous import.
+func (r *rejects) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reasons = make(map[string]int)
+}
+
+// header writes the header of the reject output: the columns of the imported
+// file followed by the line number and the reason.
+func (r *rejects) header(columns []string) {
+	if r.w == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.w.Write(append(append([]string{}, columns...), "line", "reason"))
+}
+
+// add accounts a failed line. The error of writing the reject output is kept
+// by the csv writer and reported by flush.
+func (r *rejects) add(line int, record []string, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reasons[reason]++
+
+	if r.w == nil {
+		return
+	}
+
+	r.w.Write(append(append([]string{}, record...), strconv.Itoa(line), reason))
+}
+
+// counts returns a copy of failed lines amount by reason.
+func (r *rejects) counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[string]int, len(r.reasons))
+	for reason, count := range r.reasons {
+		counts[reason] = count
+	}
+
+	return counts
+}
+
+// flush writes buffered lines to the reject output.
+func (r *rejects) flush() error {
+	if r.w == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.w.Flush()
+	return r.w.Error()
+}
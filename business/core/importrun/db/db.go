@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.uber.org/zap"
+)
+
+type Store struct {
+	log *zap.SugaredLogger
+	db  *sqlx.DB
+	tx  *sqlx.Tx
+}
+
+// NewStore constructs a data for api access.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB, tx *sqlx.Tx) Store {
+	return Store{
+		log: log,
+		db:  db,
+		tx:  tx,
+	}
+}
+
+// getConn returns a required execution context: transaction or database connection
+func (s Store) getConn() sqlx.ExtContext {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return s.db
+}
+
+// Create adds a Run to the database.
+func (s Store) Create(ctx context.Context, run Run) error {
+	const q = `
+	INSERT INTO import_runs
+		(uuid, file_name, checksum, generation_id, status, line, good_lines, failed_lines, date_created, date_updated)
+	VALUES
+		(:uuid, :file_name, :checksum, :generation_id, :status, :line, :good_lines, :failed_lines, :date_created, :date_updated)`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, run); err != nil {
+		return fmt.Errorf("inserting run: %w", err)
+	}
+
+	return nil
+}
+
+// Update replaces the checksum, the progress, the status and the result of a
+// Run in the database.
+func (s Store) Update(ctx context.Context, run Run) error {
+	const q = `
+	UPDATE
+		import_runs
+	SET
+		checksum = :checksum,
+		status = :status,
+		line = :line,
+		good_lines = :good_lines,
+		failed_lines = :failed_lines,
+		total_lines = :total_lines,
+		inserted = :inserted,
+		updated = :updated,
+		unchanged = :unchanged,
+		deleted = :deleted,
+		error = :error,
+		date_updated = :date_updated,
+		date_finished = :date_finished
+	WHERE
+		uuid = :uuid`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, run); err != nil {
+		return fmt.Errorf("updating runUUID[%q]: %w", run.UUID, err)
+	}
+
+	return nil
+}
+
+// QueryByUUID gets the specified run from the database.
+func (s Store) QueryByUUID(ctx context.Context, runUUID string) (Run, error) {
+	data := struct {
+		UUID string `db:"uuid"`
+	}{
+		UUID: runUUID,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		import_runs
+	WHERE 
+		uuid = :uuid`
+
+	var run Run
+	if err := database.NamedQueryStruct(ctx, s.getConn(), q, data, &run); err != nil {
+		return Run{}, fmt.Errorf("selecting runUUID[%q]: %w", runUUID, err)
+	}
+
+	return run, nil
+}
+
+// QueryLatest gets the most recently started run from the database.
+func (s Store) QueryLatest(ctx context.Context) (Run, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		import_runs
+	ORDER BY
+		date_created DESC
+	LIMIT 1`
+
+	var run Run
+	if err := database.NamedQueryStruct(ctx, s.getConn(), q, struct{}{}, &run); err != nil {
+		return Run{}, fmt.Errorf("selecting latest run: %w", err)
+	}
+
+	return run, nil
+}
+
+// Query gets a page of runs from the database, the most recent first.
+func (s Store) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Run, error) {
+	data := struct {
+		Offset      int `db:"offset"`
+		RowsPerPage int `db:"rows_per_page"`
+	}{
+		Offset:      (pageNumber - 1) * rowsPerPage,
+		RowsPerPage: rowsPerPage,
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		import_runs
+	ORDER BY
+		date_created DESC
+	LIMIT :offset, :rows_per_page`
+
+	var runs []Run
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, data, &runs); err != nil {
+		return nil, fmt.Errorf("selecting runs: %w", err)
+	}
+
+	return runs, nil
+}
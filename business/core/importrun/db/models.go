@@ -0,0 +1,26 @@
+// Package db is a package for keeping all db-related logic
+package db
+
+import (
+	"time"
+)
+
+type Run struct {
+	UUID         string     `db:"uuid"`          // Unique identifier.
+	FileName     string     `db:"file_name"`     // Name of the imported file.
+	Checksum     string     `db:"checksum"`      // Checksum of the imported file.
+	GenerationID int64      `db:"generation_id"` // Generation of the staging tables the run imports into.
+	Status       string     `db:"status"`        // Status of the run.
+	Line         int        `db:"line"`          // Last line committed to the database.
+	GoodLines    int        `db:"good_lines"`    // Amount of imported lines up to the committed line.
+	FailedLines  int        `db:"failed_lines"`  // Amount of failed lines up to the committed line.
+	TotalLines   int        `db:"total_lines"`   // Amount of read lines when the run ended.
+	Inserted     int        `db:"inserted"`      // Amount of inserted locations.
+	Updated      int        `db:"updated"`       // Amount of updated locations.
+	Unchanged    int        `db:"unchanged"`     // Amount of unchanged locations.
+	Deleted      int        `db:"deleted"`       // Amount of deleted locations.
+	Error        string     `db:"error"`         // Why the run failed.
+	DateCreated  time.Time  `db:"date_created"`  // When the run was started.
+	DateUpdated  time.Time  `db:"date_updated"`  // When the run was last modified.
+	DateFinished *time.Time `db:"date_finished"` // When the run ended.
+}
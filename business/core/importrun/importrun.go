@@ -0,0 +1,160 @@
+// Package importrun provides a core business API to keep track of the import
+// runs and their progress.
+package importrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/core/importrun/db"
+	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Set of error variables for CRUD operations.
+var (
+	ErrNotFound   = errors.New("run not found")
+	ErrValidation = errors.New("validation failed")
+)
+
+// MaxRowsPerPage limits the size of a page of runs.
+const MaxRowsPerPage = 100
+
+// maxErrorLen is the size of the error column of runs.
+const maxErrorLen = 1024
+
+// Core manages the set of APIs for run access.
+type Core struct {
+	store db.Store
+}
+
+// NewCore constructs a core for run api access.
+func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, tx *sqlx.Tx) Core {
+	return Core{
+		store: db.NewStore(log, dbConn, tx),
+	}
+}
+
+// Create starts a new Run in the database.
+func (c Core) Create(ctx context.Context, run NewRun, now time.Time) (Run, error) {
+	validate := validator.New()
+	err := validate.Struct(run)
+	if err != nil {
+		return Run{}, ErrValidation
+	}
+
+	dbRun := db.Run{
+		UUID:         uuid.New().String(),
+		FileName:     run.FileName,
+		Checksum:     run.Checksum,
+		GenerationID: run.GenerationID,
+		Status:       StatusRunning,
+		DateCreated:  now,
+		DateUpdated:  now,
+	}
+
+	if err := c.store.Create(ctx, dbRun); err != nil {
+		return Run{}, fmt.Errorf("create: %w", err)
+	}
+
+	return toRun(dbRun), nil
+}
+
+// UpdateCheckpoint stores the progress of a running Run.
+func (c Core) UpdateCheckpoint(ctx context.Context, run Run, cp Checkpoint, now time.Time) (Run, error) {
+	run.Line = cp.Line
+	run.GoodLines = cp.GoodLines
+	run.FailedLines = cp.FailedLines
+	run.DateUpdated = now
+
+	if err := c.store.Update(ctx, toDBRun(run)); err != nil {
+		return Run{}, fmt.Errorf("update checkpoint: %w", err)
+	}
+
+	return run, nil
+}
+
+// Finish records the result of a Run which ended. The error is cut to the size
+// of its column, a checksum of the result replaces the one of the Run.
+func (c Core) Finish(ctx context.Context, run Run, res Result, now time.Time) (Run, error) {
+	if len(res.Error) > maxErrorLen {
+		res.Error = res.Error[:maxErrorLen]
+	}
+
+	run.Status = res.Status
+	run.TotalLines = res.TotalLines
+	run.Inserted = res.Inserted
+	run.Updated = res.Updated
+	run.Unchanged = res.Unchanged
+	run.Deleted = res.Deleted
+	run.Error = res.Error
+	run.DateUpdated = now
+	run.DateFinished = &now
+	if res.Checksum != "" {
+		run.Checksum = res.Checksum
+	}
+
+	if err := c.store.Update(ctx, toDBRun(run)); err != nil {
+		return Run{}, fmt.Errorf("finish: %w", err)
+	}
+
+	return run, nil
+}
+
+// Restart marks a Run which ended without finishing as running again.
+func (c Core) Restart(ctx context.Context, run Run, now time.Time) (Run, error) {
+	run.Status = StatusRunning
+	run.Error = ""
+	run.DateUpdated = now
+	run.DateFinished = nil
+
+	if err := c.store.Update(ctx, toDBRun(run)); err != nil {
+		return Run{}, fmt.Errorf("restart: %w", err)
+	}
+
+	return run, nil
+}
+
+// QueryByUUID gets the specified run from the database.
+func (c Core) QueryByUUID(ctx context.Context, runUUID string) (Run, error) {
+	dbRun, err := c.store.QueryByUUID(ctx, runUUID)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Run{}, ErrNotFound
+		}
+		return Run{}, fmt.Errorf("query: %w", err)
+	}
+
+	return toRun(dbRun), nil
+}
+
+// QueryLatest gets the most recently started run from the database.
+func (c Core) QueryLatest(ctx context.Context) (Run, error) {
+	dbRun, err := c.store.QueryLatest(ctx)
+	if err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Run{}, ErrNotFound
+		}
+		return Run{}, fmt.Errorf("query: %w", err)
+	}
+
+	return toRun(dbRun), nil
+}
+
+// Query gets a page of runs, the most recent first.
+func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Run, error) {
+	if pageNumber < 1 || rowsPerPage < 1 || rowsPerPage > MaxRowsPerPage {
+		return nil, ErrValidation
+	}
+
+	dbRuns, err := c.store.Query(ctx, pageNumber, rowsPerPage)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return toRunSlice(dbRuns), nil
+}
@@ -0,0 +1,81 @@
+package importrun
+
+import (
+	"github.com/mchusovlianov/geodata/business/core/importrun/db"
+	"time"
+	"unsafe"
+)
+
+// Set of statuses of a run.
+const (
+	StatusRunning     = "running"
+	StatusFinished    = "finished"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Run
+type Run struct {
+	UUID         string     `json:"uuid"`          // Unique identifier.
+	FileName     string     `json:"file_name"`     // Name of the imported file.
+	Checksum     string     `json:"checksum"`      // Checksum of the imported file.
+	GenerationID int64      `json:"generation_id"` // Generation of the staging tables the run imports into.
+	Status       string     `json:"status"`        // Status of the run.
+	Line         int        `json:"line"`          // Last line committed to the database.
+	GoodLines    int        `json:"good_lines"`    // Amount of imported lines up to the committed line.
+	FailedLines  int        `json:"failed_lines"`  // Amount of failed lines up to the committed line.
+	TotalLines   int        `json:"total_lines"`   // Amount of read lines when the run ended.
+	Inserted     int        `json:"inserted"`      // Amount of inserted locations.
+	Updated      int        `json:"updated"`       // Amount of updated locations.
+	Unchanged    int        `json:"unchanged"`     // Amount of unchanged locations.
+	Deleted      int        `json:"deleted"`       // Amount of deleted locations.
+	Error        string     `json:"error"`         // Why the run failed.
+	DateCreated  time.Time  `json:"date_created"`  // When the run was started.
+	DateUpdated  time.Time  `json:"date_updated"`  // When the run was last modified.
+	DateFinished *time.Time `json:"date_finished"` // When the run ended.
+}
+
+// NewRun is what we require when starting a Run.
+type NewRun struct {
+	FileName     string `json:"file_name" validate:"required"`
+	Checksum     string `json:"checksum"`
+	GenerationID int64  `json:"generation_id"`
+}
+
+// Checkpoint is the progress of a Run committed to the database.
+type Checkpoint struct {
+	Line        int
+	GoodLines   int
+	FailedLines int
+}
+
+// Result is the outcome of a Run when it ends. Good and failed lines are kept
+// from the last checkpoint, so a failed Run can still be resumed.
+type Result struct {
+	Status     string
+	TotalLines int
+	Inserted   int
+	Updated    int
+	Unchanged  int
+	Deleted    int
+	Error      string
+	Checksum   string // Checksum of the file if it wasn't known when the run started.
+}
+
+func toRun(dbRun db.Run) Run {
+	r := (*Run)(unsafe.Pointer(&dbRun))
+	return *r
+}
+
+func toRunSlice(dbRuns []db.Run) []Run {
+	runs := make([]Run, len(dbRuns))
+	for i, dbRun := range dbRuns {
+		runs[i] = toRun(dbRun)
+	}
+	return runs
+}
+
+func toDBRun(run Run) db.Run {
+	r := (*db.Run)(unsafe.Pointer(&run))
+	return *r
+}
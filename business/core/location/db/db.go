@@ -2,24 +2,48 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
 	"go.uber.org/zap"
+	"math/bits"
+	"strings"
+	"sync"
 )
 
+// spanCache keeps the spans of the ip ranges of a generation of the dataset,
+// so lookups don't read them every time.
+type spanCache struct {
+	mu     sync.RWMutex
+	loaded bool
+	gen    int64
+	spans  []int
+}
+
+// reset drops the cached spans, ranges of other spans may have been stored.
+func (c *spanCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loaded = false
+}
+
 type Store struct {
-	log *zap.SugaredLogger
-	db  *sqlx.DB
-	tx  *sqlx.Tx
+	log   *zap.SugaredLogger
+	db    *sqlx.DB
+	tx    *sqlx.Tx
+	spans *spanCache
 }
 
 // NewStore constructs a data for api access.
 func NewStore(log *zap.SugaredLogger, db *sqlx.DB, tx *sqlx.Tx) Store {
 	return Store{
-		log: log,
-		db:  db,
-		tx:  tx,
+		log:   log,
+		db:    db,
+		tx:    tx,
+		spans: &spanCache{},
 	}
 }
 
@@ -37,17 +61,133 @@ func (s Store) getConn() sqlx.ExtContext {
 func (s Store) Create(ctx context.Context, location Location) error {
 	const q = `
 	INSERT INTO locations
-		(uuid, city_uuid, mystery_value, ip, latitude, longitude, date_created, date_updated)
+		(uuid, city_uuid, mystery_value, ip_from, ip_to, ip_span, latitude, longitude, geohash, date_created, date_updated)
 	VALUES
-		(:uuid, :city_uuid, :mystery_value, :ip, :latitude, :longitude, :date_created, :date_updated)`
+		(:uuid, :city_uuid, :mystery_value, :ip_from, :ip_to, :ip_span, :latitude, :longitude, :geohash, :date_created, :date_updated)`
 
 	if err := database.NamedExecContext(ctx, s.getConn(), q, location); err != nil {
 		return fmt.Errorf("inserting location: %w", err)
 	}
+	s.spans.reset()
+
+	return nil
+}
+
+// CreateBatch adds a set of locations to the database with a single multi-row
+// insert. Either all locations are inserted or none of them.
+func (s Store) CreateBatch(ctx context.Context, locations []Location) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	const q = `
+	INSERT INTO locations
+		(uuid, city_uuid, mystery_value, ip_from, ip_to, ip_span, latitude, longitude, geohash, date_created, date_updated)
+	VALUES
+		(:uuid, :city_uuid, :mystery_value, :ip_from, :ip_to, :ip_span, :latitude, :longitude, :geohash, :date_created, :date_updated)`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, locations); err != nil {
+		return fmt.Errorf("inserting %d locations: %w", len(locations), err)
+	}
+	s.spans.reset()
+
+	return nil
+}
+
+// UpsertBatch adds a set of locations to the database with a single multi-row
+// insert. Locations with an ip range which already exists replace the city,
+// coordinates and mystery value of the existing ones, keeping their uuid.
+func (s Store) UpsertBatch(ctx context.Context, locations []Location) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	const q = `
+	INSERT INTO locations
+		(uuid, city_uuid, mystery_value, ip_from, ip_to, ip_span, latitude, longitude, geohash, date_created, date_updated)
+	VALUES
+		(:uuid, :city_uuid, :mystery_value, :ip_from, :ip_to, :ip_span, :latitude, :longitude, :geohash, :date_created, :date_updated)
+	ON DUPLICATE KEY UPDATE
+		city_uuid = VALUES(city_uuid),
+		mystery_value = VALUES(mystery_value),
+		latitude = VALUES(latitude),
+		longitude = VALUES(longitude),
+		geohash = VALUES(geohash),
+		date_updated = VALUES(date_updated)`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, locations); err != nil {
+		return fmt.Errorf("upserting %d locations: %w", len(locations), err)
+	}
+	s.spans.reset()
+
+	return nil
+}
+
+// ResetSeen prepares an empty table to record ip ranges seen by an import.
+func (s Store) ResetSeen(ctx context.Context) error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS seen_ips (ip_from VARBINARY(16), ip_to VARBINARY(16), PRIMARY KEY (ip_from, ip_to))`,
+		`TRUNCATE TABLE seen_ips`,
+	}
+
+	for _, q := range queries {
+		if _, err := s.getConn().ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("resetting seen ips: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MarkSeen records ip ranges as seen by an import.
+func (s Store) MarkSeen(ctx context.Context, ranges []IPRange) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	const q = `
+	INSERT IGNORE INTO seen_ips
+		(ip_from, ip_to)
+	VALUES
+		(:ip_from, :ip_to)`
+
+	if err := database.NamedExecContext(ctx, s.getConn(), q, ranges); err != nil {
+		return fmt.Errorf("marking %d ips as seen: %w", len(ranges), err)
+	}
 
 	return nil
 }
 
+// DeleteUnseen deletes locations with ip ranges not seen by an import and
+// drops the table of seen ips. It returns the number of deleted locations.
+func (s Store) DeleteUnseen(ctx context.Context) (int, error) {
+	const q = `
+	DELETE
+		l
+	FROM
+		locations AS l
+	LEFT JOIN
+		seen_ips AS s ON s.ip_from = l.ip_from AND s.ip_to = l.ip_to
+	WHERE
+		s.ip_from IS NULL`
+
+	res, err := s.getConn().ExecContext(ctx, q)
+	if err != nil {
+		return 0, fmt.Errorf("deleting unseen locations: %w", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("counting deleted locations: %w", err)
+	}
+
+	if _, err := s.getConn().ExecContext(ctx, `DROP TABLE IF EXISTS seen_ips`); err != nil {
+		return 0, fmt.Errorf("dropping seen ips: %w", err)
+	}
+
+	return int(deleted), nil
+}
+
 // QueryByUUID gets the specified location from the database by uuid.
 func (s Store) QueryByUUID(ctx context.Context, locationUUID string) (Location, error) {
 	data := struct {
@@ -72,31 +212,94 @@ func (s Store) QueryByUUID(ctx context.Context, locationUUID string) (Location,
 	return location, nil
 }
 
-// QueryByIP gets the specified location from the database by ip-address.
-func (s Store) QueryByIP(ctx context.Context, ip string) (Location, error) {
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address given as 16 bytes. Of nested ranges the one starting last and
+// ending first is the most specific. Only the blocks of the index which may
+// hold a range containing the address are read, see SpanWhere.
+func (s Store) QueryByIP(ctx context.Context, ip []byte) (Location, error) {
 	data := struct {
-		IP string `db:"ip"`
+		IP []byte `db:"ip"`
 	}{
 		IP: ip,
 	}
 
+	var location Location
+	err := s.WithSpans(ctx, func(gen int64, spans []int) error {
+		if len(spans) == 0 {
+			return database.ErrDBNotFound
+		}
+
+		q := `
+		SELECT
+			*
+		FROM
+			locations
+		WHERE
+			ip_from <= :ip AND ip_to >= :ip AND ` + SpanWhere("", spans, ip) + ` AND ` + GenerationWhere(gen) + `
+		ORDER BY
+			ip_from DESC, ip_to ASC
+		LIMIT 1`
+
+		return database.NamedQueryStruct(ctx, s.getConn(), q, data, &location)
+	})
+	if err != nil {
+		return Location{}, fmt.Errorf("selecting locationIP[%x]: %w", ip, err)
+	}
+
+	return location, nil
+}
+
+// QueryManyByIPFrom gets the locations with ip ranges starting at the given
+// addresses from the database.
+func (s Store) QueryManyByIPFrom(ctx context.Context, froms [][]byte) ([]Location, error) {
+	if len(froms) == 0 {
+		return nil, nil
+	}
+
+	data := struct {
+		IPFroms [][]byte `db:"ip_froms"`
+	}{
+		IPFroms: froms,
+	}
+
 	const q = `
 	SELECT
 		*
 	FROM
 		locations
-	WHERE 
-		ip = :ip`
+	WHERE
+		ip_from IN (:ip_froms)`
 
-	var location Location
-	if err := database.NamedQueryStruct(ctx, s.getConn(), q, data, &location); err != nil {
-		return Location{}, fmt.Errorf("selecting locationIP[%q]: %w", ip, err)
+	var locations []Location
+	if err := database.NamedQuerySliceUsingIn(ctx, s.getConn(), q, data, &locations); err != nil {
+		return nil, fmt.Errorf("selecting %d locations by ip range: %w", len(froms), err)
 	}
 
-	return location, nil
+	return locations, nil
+}
+
+// Query gets a page of locations from the database.
+func (s Store) Query(ctx context.Context, ks page.Keyset) ([]Location, error) {
+	q := fmt.Sprintf(`
+	SELECT
+		*
+	FROM
+		locations
+	WHERE
+		%s
+	ORDER BY
+		%s
+	LIMIT :limit`, ks.Where("uuid"), ks.OrderBy("uuid"))
+
+	var locations []Location
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, ks.Args(map[string]any{}), &locations); err != nil {
+		return nil, fmt.Errorf("selecting locations: %w", err)
+	}
+
+	return locations, nil
 }
 
-// QueryAll gets all countries from the database.
+// QueryAll gets all locations from the database.
 func (s Store) QueryAll(ctx context.Context) ([]Location, error) {
 	const q = `
 	SELECT
@@ -111,3 +314,196 @@ func (s Store) QueryAll(ctx context.Context) ([]Location, error) {
 
 	return locations, nil
 }
+
+// QueryByBox gets a page of locations inside the box. The order follows the
+// index on latitude and longitude, which holds the uuid as the primary key, so
+// the next page starts right after the cursor without sorting.
+func (s Store) QueryByBox(ctx context.Context, box Box) ([]Location, error) {
+	data := map[string]any{
+		"min_lat":      box.MinLatitude,
+		"max_lat":      box.MaxLatitude,
+		"min_lon":      box.MinLongitude,
+		"max_lon":      box.MaxLongitude,
+		"country_code": box.CountryCode,
+		"limit":        box.Limit,
+	}
+
+	var join string
+	if box.CountryCode != "" {
+		join = `
+	JOIN
+		cities ci ON ci.uuid = l.city_uuid
+	JOIN
+		countries co ON co.uuid = ci.country_uuid AND co.code = :country_code`
+	}
+
+	lon := "l.longitude BETWEEN :min_lon AND :max_lon"
+	if box.MinLongitude > box.MaxLongitude {
+		lon = "(l.longitude >= :min_lon OR l.longitude <= :max_lon)"
+	}
+
+	var after string
+	if box.After != nil {
+		data["after_lat"] = box.After.Latitude
+		data["after_lon"] = box.After.Longitude
+		data["after_uuid"] = box.After.UUID
+
+		after = `
+		AND (l.latitude > :after_lat OR (l.latitude = :after_lat AND
+			(l.longitude > :after_lon OR (l.longitude = :after_lon AND l.uuid > :after_uuid))))`
+	}
+
+	q := `
+	SELECT
+		l.*
+	FROM
+		locations l` + join + `
+	WHERE
+		l.latitude BETWEEN :min_lat AND :max_lat
+		AND ` + lon + after + `
+	ORDER BY
+		l.latitude, l.longitude, l.uuid
+	LIMIT :limit`
+
+	var locations []Location
+	if err := database.NamedQuerySlice(ctx, s.getConn(), q, data, &locations); err != nil {
+		return nil, fmt.Errorf("selecting locations in box: %w", err)
+	}
+
+	return locations, nil
+}
+
+// WithSpans runs the query with the spans of the ip ranges of a generation of
+// the dataset, see GenerationWhere. The spans are cached until ranges are
+// stored by the store, they are read again as well when the query finds nothing
+// and another generation became live since.
+func (s Store) WithSpans(ctx context.Context, query func(gen int64, spans []int) error) error {
+	s.spans.mu.RLock()
+	loaded, gen, spans := s.spans.loaded, s.spans.gen, s.spans.spans
+	s.spans.mu.RUnlock()
+
+	if !loaded {
+		var err error
+		if gen, spans, err = s.loadSpans(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := query(gen, spans)
+	if !errors.Is(err, database.ErrDBNotFound) {
+		return err
+	}
+
+	current, qerr := s.queryGeneration(ctx)
+	if qerr != nil {
+		return qerr
+	}
+	if current == gen {
+		return err
+	}
+
+	if gen, spans, err = s.loadSpans(ctx); err != nil {
+		return err
+	}
+
+	return query(gen, spans)
+}
+
+// GenerationWhere returns the condition holding only while the generation is
+// the one of the dataset, 0 stands for a dataset without a generation.
+func GenerationWhere(gen int64) string {
+	return fmt.Sprintf("COALESCE((SELECT generation_id FROM dataset_generation LIMIT 1), 0) = %d", gen)
+}
+
+// loadSpans reads the generation of the dataset and then the spans of its ip
+// ranges into the cache. If another generation becomes live in between, the
+// cached generation is the old one, so lookups read the spans again.
+func (s Store) loadSpans(ctx context.Context) (int64, []int, error) {
+	gen, err := s.queryGeneration(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	spans, err := s.querySpans(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.spans.mu.Lock()
+	s.spans.loaded, s.spans.gen, s.spans.spans = true, gen, spans
+	s.spans.mu.Unlock()
+
+	return gen, spans, nil
+}
+
+// queryGeneration gets the id of the generation of the dataset, 0 if it has
+// none.
+func (s Store) queryGeneration(ctx context.Context) (int64, error) {
+	const q = `
+	SELECT
+		COALESCE((SELECT generation_id FROM dataset_generation LIMIT 1), 0) AS generation_id`
+
+	var row struct {
+		ID int64 `db:"generation_id"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.getConn(), q, struct{}{}, &row); err != nil {
+		return 0, fmt.Errorf("selecting generation: %w", err)
+	}
+
+	return row.ID, nil
+}
+
+// querySpans gets the distinct spans of the stored ip ranges, see SpanWhere.
+func (s Store) querySpans(ctx context.Context) ([]int, error) {
+	const q = `
+	SELECT DISTINCT
+		ip_span
+	FROM
+		locations`
+
+	var rows []struct {
+		Span int `db:"ip_span"`
+	}
+	if err := database.QuerySlice(ctx, s.getConn(), q, nil, &rows); err != nil {
+		return nil, fmt.Errorf("selecting ip spans: %w", err)
+	}
+
+	spans := make([]int, len(rows))
+	for i, row := range rows {
+		spans[i] = row.Span
+	}
+
+	return spans, nil
+}
+
+// IPSpan returns the span of an ip range given by 16 byte keys: the bit length
+// of the bits its first and last addresses differ in. The range lies in the
+// block of 2^span addresses aligned to its size.
+func IPSpan(from, to []byte) int {
+	for i := range from {
+		if x := from[i] ^ to[i]; x != 0 {
+			return (len(from)-i-1)*8 + bits.Len8(x)
+		}
+	}
+
+	return 0
+}
+
+// SpanWhere returns the condition selecting the ranges which may contain the
+// ip-address among the ranges of the spans. A range containing the address
+// lies in the aligned block of its span around the address, so for every span
+// only the ranges starting in that block are read from the index on ip_span
+// and ip_from, however many ranges start before it.
+func SpanWhere(alias string, spans []int, ip []byte) string {
+	conds := make([]string, len(spans))
+	for i, span := range spans {
+		start := make([]byte, len(ip))
+		copy(start, ip)
+		for bit := 0; bit < span && bit < 8*len(start); bit++ {
+			start[len(start)-1-bit/8] &^= 1 << (bit % 8)
+		}
+		conds[i] = fmt.Sprintf("(%[1]sip_span = %[2]d AND %[1]sip_from >= X'%[3]x')", alias, span, start)
+	}
+
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
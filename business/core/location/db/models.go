@@ -8,10 +8,39 @@ import (
 type Location struct {
 	UUID         string    `db:"uuid"`          // Unique identifier.
 	CityUUID     string    `db:"city_uuid"`     // Unique identifier of the linked city.
-	IP           string    `db:"ip"`            // IP of the location.
+	IPFrom       []byte    `db:"ip_from"`       // First address of the ip range as 16 bytes.
+	IPTo         []byte    `db:"ip_to"`         // Last address of the ip range as 16 bytes.
+	IPSpan       int       `db:"ip_span"`       // Span of the ip range, see IPSpan.
 	Latitude     float64   `db:"latitude"`      // Latitude of the location.
 	Longitude    float64   `db:"longitude"`     // Longitude of the location.
+	Geohash      string    `db:"geohash"`       // Geohash of the coordinates.
 	MysteryValue int64     `db:"mystery_value"` // Mystery value of the location.
 	DateCreated  time.Time `db:"date_created"`  // When the location was added.
 	DateUpdated  time.Time `db:"date_updated"`  // When the location was last modified.
 }
+
+// IPRange is an ip range given by its first and last addresses as 16 bytes.
+type IPRange struct {
+	IPFrom []byte `db:"ip_from"` // First address of the range.
+	IPTo   []byte `db:"ip_to"`   // Last address of the range.
+}
+
+// Box is a search of locations inside a box of coordinates ordered by latitude,
+// longitude and uuid. A box with MinLongitude greater than MaxLongitude crosses
+// the antimeridian.
+type Box struct {
+	MinLatitude  float64 // Southern edge of the box.
+	MaxLatitude  float64 // Northern edge of the box.
+	MinLongitude float64 // Western edge of the box.
+	MaxLongitude float64 // Eastern edge of the box.
+	CountryCode  string  // Code of the country of the locations, any if empty.
+	After        *Cursor // Position of the last location of the previous page.
+	Limit        int     // Largest number of the locations.
+}
+
+// Cursor is the position of a location in the order of a box search.
+type Cursor struct {
+	Latitude  float64 // Latitude of the location.
+	Longitude float64 // Longitude of the location.
+	UUID      string  // Unique identifier of the location.
+}
@@ -0,0 +1,155 @@
+package location
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrInvalidIPRange is returned when a string is not an address, a CIDR block
+// or a range of addresses.
+var ErrInvalidIPRange = errors.New("invalid ip range")
+
+// IPRange is a continuous range of ip-addresses, both ends are included. Single
+// addresses and CIDR blocks are ranges as well.
+type IPRange struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// ParseIPRange parses a single address, a CIDR block like "10.0.0.0/8" or a
+// range written as "10.0.0.1-10.0.0.9". Host bits of a CIDR block are ignored.
+func ParseIPRange(s string) (IPRange, error) {
+	s = strings.TrimSpace(s)
+
+	if start, end, ok := strings.Cut(s, "-"); ok {
+		from, err := parseAddr(start)
+		if err != nil {
+			return IPRange{}, err
+		}
+
+		to, err := parseAddr(end)
+		if err != nil {
+			return IPRange{}, err
+		}
+
+		if from.BitLen() != to.BitLen() || to.Less(from) {
+			return IPRange{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, s)
+		}
+
+		return IPRange{From: from, To: to}, nil
+	}
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return IPRange{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, s)
+		}
+
+		addr, bits := prefix.Addr(), prefix.Bits()
+		if addr.Is4In6() {
+			addr, bits = addr.Unmap(), bits-96
+		}
+
+		prefix = netip.PrefixFrom(addr, bits).Masked()
+		if !prefix.IsValid() {
+			return IPRange{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, s)
+		}
+
+		return IPRange{From: prefix.Addr(), To: lastAddr(prefix)}, nil
+	}
+
+	addr, err := parseAddr(s)
+	if err != nil {
+		return IPRange{}, err
+	}
+
+	return IPRange{From: addr, To: addr}, nil
+}
+
+// String returns the canonical form of the range: the address for a single
+// one, the CIDR block if the range is exactly one, otherwise "start-end".
+func (r IPRange) String() string {
+	if r.From == r.To {
+		return r.From.String()
+	}
+
+	for bits := 0; bits <= r.From.BitLen(); bits++ {
+		prefix := netip.PrefixFrom(r.From, bits).Masked()
+		if prefix.Addr() == r.From && lastAddr(prefix) == r.To {
+			return prefix.String()
+		}
+	}
+
+	return r.From.String() + "-" + r.To.String()
+}
+
+// ParseIP parses a single address. IPv4-mapped IPv6 addresses are converted to
+// IPv4 ones.
+func ParseIP(s string) (netip.Addr, error) {
+	return parseAddr(strings.TrimSpace(s))
+}
+
+// IPKey returns the address as 16 bytes, IPv4 addresses are mapped to IPv6
+// ones. Keys of all addresses are ordered the same way as the addresses.
+func IPKey(addr netip.Addr) []byte {
+	key := addr.As16()
+	return key[:]
+}
+
+// toIPRange converts a range given by 16 byte keys of its addresses.
+func toIPRange(from, to []byte) IPRange {
+	return IPRange{
+		From: addrFromKey(from),
+		To:   addrFromKey(to),
+	}
+}
+
+// addrFromKey converts a 16 byte key back to the address. A key of another
+// length gives an invalid address.
+func addrFromKey(key []byte) netip.Addr {
+	addr, ok := netip.AddrFromSlice(key)
+	if !ok {
+		return netip.Addr{}
+	}
+
+	return addr.Unmap()
+}
+
+// parseAddr parses an address without a zone and unmaps IPv4-mapped ones.
+func parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, s)
+	}
+
+	return addr.Unmap(), nil
+}
+
+// lastAddr returns the last address of the CIDR block.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr()
+	if addr.Is4() {
+		b := addr.As4()
+		setHostBits(b[:], prefix.Bits())
+		return netip.AddrFrom4(b)
+	}
+
+	b := addr.As16()
+	setHostBits(b[:], prefix.Bits())
+	return netip.AddrFrom16(b)
+}
+
+// setHostBits sets all bits after the first bits of the address to one.
+func setHostBits(b []byte, bits int) {
+	for i := range b {
+		switch {
+		case bits >= 8*(i+1):
+		case bits <= 8*i:
+			b[i] = 0xff
+		default:
+			b[i] |= 0xff >> (bits - 8*i)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package location_test
+
+import (
+	"bytes"
+	"github.com/mchusovlianov/geodata/business/core/location"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"net/netip"
+	"testing"
+)
+
+func Test_ParseIPRange(t *testing.T) {
+	t.Log("Given the need to parse ip ranges.")
+	{
+		good := []struct {
+			in   string
+			from string
+			to   string
+			text string
+		}{
+			{"200.106.141.15", "200.106.141.15", "200.106.141.15", "200.106.141.15"},
+			{"::ffff:200.106.141.15", "200.106.141.15", "200.106.141.15", "200.106.141.15"},
+			{"2001:0db8:0000::1", "2001:db8::1", "2001:db8::1", "2001:db8::1"},
+			{"10.1.2.3/16", "10.1.0.0", "10.1.255.255", "10.1.0.0/16"},
+			{"::ffff:10.1.0.0/112", "10.1.0.0", "10.1.255.255", "10.1.0.0/16"},
+			{"2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", "2001:db8::/32"},
+			{"10.0.0.0-10.0.0.255", "10.0.0.0", "10.0.0.255", "10.0.0.0/24"},
+			{"10.0.0.1-10.0.0.9", "10.0.0.1", "10.0.0.9", "10.0.0.1-10.0.0.9"},
+		}
+
+		for testID, tt := range good {
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, tt.in)
+			{
+				r, err := location.ParseIPRange(tt.in)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse the range: %s.", tests.Failed, testID, err)
+				}
+
+				if r.From.String() != tt.from || r.To.String() != tt.to || r.String() != tt.text {
+					t.Fatalf("\t%s\tTest %d:\tShould get %s-%s as %s, got %s-%s as %s.", tests.Failed, testID, tt.from, tt.to, tt.text, r.From, r.To, r)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to parse the range.", tests.Success, testID)
+			}
+		}
+
+		bad := []string{"", "12345", "200.106.141", "10.0.0.9-10.0.0.1", "10.0.0.1-2001:db8::1", "fe80::1%eth0", "10.0.0.0/33"}
+		for i, in := range bad {
+			testID := len(good) + i
+			t.Logf("\tTest %d:\tWhen parsing %q.", testID, in)
+			{
+				if _, err := location.ParseIPRange(in); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to parse the range.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not be able to parse the range.", tests.Success, testID)
+			}
+		}
+
+		testID := len(good) + len(bad)
+		t.Logf("\tTest %d:\tWhen comparing keys of addresses.", testID)
+		{
+			v4 := location.IPKey(netip.MustParseAddr("255.255.255.255"))
+			v6 := location.IPKey(netip.MustParseAddr("2001:db8::1"))
+			mapped := location.IPKey(netip.MustParseAddr("::ffff:255.255.255.255"))
+
+			if len(v4) != 16 || !bytes.Equal(v4, mapped) || bytes.Compare(v4, v6) >= 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould map IPv4 addresses into the IPv6 space.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould map IPv4 addresses into the IPv6 space.", tests.Success, testID)
+		}
+	}
+}
@@ -5,23 +5,37 @@ package location
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/mchusovlianov/geodata/business/core/location/db"
+	"github.com/mchusovlianov/geodata/business/data/page"
 	"github.com/mchusovlianov/geodata/foundation/database"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/business/core/location")
+
 // Set of error variables for CRUD operations.
 var (
 	ErrNotFound   = errors.New("location not found")
 	ErrValidation = errors.New("validation failed")
+	ErrDuplicate  = errors.New("location already exist")
 )
 
+// sortColumns maps the fields locations are listed by to their columns.
+var sortColumns = map[string]string{
+	"uuid": "uuid",
+}
+
 // Core manages the set of APIs for location access.
 type Core struct {
 	store db.Store
@@ -37,32 +51,145 @@ func NewCore(log *zap.SugaredLogger, dbConn *sqlx.DB, tx *sqlx.Tx) Core {
 // Create adds a Location to the database. It returns the created Location with
 // fields like ID and DateCreated populated.
 func (c Core) Create(ctx context.Context, location NewLocation, now time.Time) (Location, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.create")
+	defer span.End()
+
 	validate := validator.New()
 	err := validate.Struct(location)
 	if err != nil {
 		return Location{}, ErrValidation
 	}
 
-	dbLocation := db.Location{
-		UUID:         uuid.New().String(),
-		CityUUID:     location.CityUUID,
-		Longitude:    location.Longitude,
-		Latitude:     location.Latitude,
-		IP:           location.IP,
-		MysteryValue: location.MysteryValue,
-		DateCreated:  now,
-		DateUpdated:  now,
+	r, err := ParseIPRange(location.IP)
+	if err != nil {
+		return Location{}, ErrValidation
 	}
 
+	dbLocation := toDBLocation(location, r, uuid.New().String(), now)
+
 	if err := c.store.Create(ctx, dbLocation); err != nil {
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			return Location{}, ErrDuplicate
+		}
+
 		return Location{}, fmt.Errorf("create: %w", err)
 	}
 
 	return toLocation(dbLocation), nil
 }
 
+// CreateBatch adds a set of Location records to the database in a single
+// statement. Either all records are created or none of them.
+func (c Core) CreateBatch(ctx context.Context, locations []NewLocation, now time.Time) ([]Location, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.createbatch")
+	defer span.End()
+
+	validate := validator.New()
+
+	dbLocations := make([]db.Location, len(locations))
+	for i, location := range locations {
+		if err := validate.Struct(location); err != nil {
+			return nil, ErrValidation
+		}
+
+		r, err := ParseIPRange(location.IP)
+		if err != nil {
+			return nil, ErrValidation
+		}
+
+		dbLocations[i] = toDBLocation(location, r, uuid.New().String(), now)
+	}
+
+	if err := c.store.CreateBatch(ctx, dbLocations); err != nil {
+		if errors.Is(err, database.ErrDBDuplicatedEntry) {
+			return nil, ErrDuplicate
+		}
+
+		return nil, fmt.Errorf("create batch: %w", err)
+	}
+
+	return toLocationSlice(dbLocations), nil
+}
+
+// UpsertBatch adds a set of Location records to the database in a single
+// statement. Records with an ip which already exists update the existing ones.
+// Either all records are written or none of them.
+func (c Core) UpsertBatch(ctx context.Context, locations []NewLocation, now time.Time) error {
+	ctx, span := tracer.Start(ctx, "business.core.location.upsertbatch")
+	defer span.End()
+
+	validate := validator.New()
+
+	dbLocations := make([]db.Location, len(locations))
+	for i, location := range locations {
+		if err := validate.Struct(location); err != nil {
+			return ErrValidation
+		}
+
+		r, err := ParseIPRange(location.IP)
+		if err != nil {
+			return ErrValidation
+		}
+
+		dbLocations[i] = toDBLocation(location, r, uuid.New().String(), now)
+	}
+
+	if err := c.store.UpsertBatch(ctx, dbLocations); err != nil {
+		return fmt.Errorf("upsert batch: %w", err)
+	}
+
+	return nil
+}
+
+// ResetSeen starts recording ips seen by an import.
+func (c Core) ResetSeen(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "business.core.location.resetseen")
+	defer span.End()
+
+	if err := c.store.ResetSeen(ctx); err != nil {
+		return fmt.Errorf("reset seen: %w", err)
+	}
+
+	return nil
+}
+
+// MarkSeen records ip ranges given in their canonical form as seen by an
+// import.
+func (c Core) MarkSeen(ctx context.Context, ips []string) error {
+	ctx, span := tracer.Start(ctx, "business.core.location.markseen")
+	defer span.End()
+
+	ranges, err := toDBIPRanges(ips)
+	if err != nil {
+		return err
+	}
+
+	if err := c.store.MarkSeen(ctx, ranges); err != nil {
+		return fmt.Errorf("mark seen: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUnseen deletes locations with ip ranges not seen by an import since
+// ResetSeen. It returns the number of deleted locations.
+func (c Core) DeleteUnseen(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.deleteunseen")
+	defer span.End()
+
+	deleted, err := c.store.DeleteUnseen(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("delete unseen: %w", err)
+	}
+
+	return deleted, nil
+}
+
 // QueryByUUID gets the specified location from the database by uuid.
 func (c Core) QueryByUUID(ctx context.Context, locationUUID string) (Location, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.querybyuuid")
+	defer span.End()
+
 	dbLocation, err := c.store.QueryByUUID(ctx, locationUUID)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -74,17 +201,18 @@ func (c Core) QueryByUUID(ctx context.Context, locationUUID string) (Location, e
 	return toLocation(dbLocation), nil
 }
 
-// QueryByIP gets the specified location from the database by ip-address.
+// QueryByIP gets the location with the most specific ip range containing the
+// ip-address.
 func (c Core) QueryByIP(ctx context.Context, ip string) (Location, error) {
-	validate := validator.New()
-	err := validate.Struct(struct {
-		IP string `validate:"required,ip"`
-	}{IP: ip})
+	ctx, span := tracer.Start(ctx, "business.core.location.querybyip")
+	defer span.End()
+
+	addr, err := ParseIP(ip)
 	if err != nil {
 		return Location{}, ErrValidation
 	}
 
-	dbLocation, err := c.store.QueryByIP(ctx, ip)
+	dbLocation, err := c.store.QueryByIP(ctx, IPKey(addr))
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
 			return Location{}, ErrNotFound
@@ -95,8 +223,99 @@ func (c Core) QueryByIP(ctx context.Context, ip string) (Location, error) {
 	return toLocation(dbLocation), nil
 }
 
+// QueryManyByIP gets the locations with exactly the given ip ranges. Ranges
+// without a location are skipped.
+func (c Core) QueryManyByIP(ctx context.Context, ips []string) ([]Location, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.querymanybyip")
+	defer span.End()
+
+	ranges, err := toDBIPRanges(ips)
+	if err != nil {
+		return nil, err
+	}
+
+	froms := make([][]byte, len(ranges))
+	wanted := make(map[string]struct{}, len(ranges))
+	for i, r := range ranges {
+		froms[i] = r.IPFrom
+		wanted[string(r.IPFrom)+string(r.IPTo)] = struct{}{}
+	}
+
+	dbLocations, err := c.store.QueryManyByIPFrom(ctx, froms)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	// ranges starting at the same address but ending elsewhere are not asked
+	matched := dbLocations[:0]
+	for _, dbLocation := range dbLocations {
+		if _, ok := wanted[string(dbLocation.IPFrom)+string(dbLocation.IPTo)]; ok {
+			matched = append(matched, dbLocation)
+		}
+	}
+
+	return toLocationSlice(matched), nil
+}
+
+// MaxBoxLimit is the largest page of a box search.
+const MaxBoxLimit = 1000
+
+// QueryByBox gets a page of up to limit locations inside the box, optionally of
+// the country with the code only. The cursor of the next page is returned with
+// the page, an empty cursor asks for the first one.
+func (c Core) QueryByBox(ctx context.Context, box BBox, countryCode string, cursor string, limit int) (LocationPage, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.querybybox")
+	defer span.End()
+
+	switch {
+	case box.MinLat < -90 || box.MaxLat > 90 || box.MinLat > box.MaxLat:
+		return LocationPage{}, ErrValidation
+	case box.MinLon < -180 || box.MinLon > 180 || box.MaxLon < -180 || box.MaxLon > 180:
+		return LocationPage{}, ErrValidation
+	case limit < 1 || limit > MaxBoxLimit:
+		return LocationPage{}, ErrValidation
+	}
+
+	dbBox := db.Box{
+		MinLatitude:  box.MinLat,
+		MaxLatitude:  box.MaxLat,
+		MinLongitude: box.MinLon,
+		MaxLongitude: box.MaxLon,
+		CountryCode:  strings.ToUpper(countryCode),
+		Limit:        limit + 1,
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return LocationPage{}, ErrValidation
+		}
+		dbBox.After = &after
+	}
+
+	dbLocations, err := c.store.QueryByBox(ctx, dbBox)
+	if err != nil {
+		return LocationPage{}, fmt.Errorf("query: %w", err)
+	}
+
+	// the location over the limit tells there is a next page
+	var next string
+	if len(dbLocations) > limit {
+		dbLocations = dbLocations[:limit]
+		next = encodeCursor(dbLocations[limit-1])
+	}
+
+	return LocationPage{
+		Locations:  toLocationSlice(dbLocations),
+		NextCursor: next,
+	}, nil
+}
+
 // QueryAll gets all locations from the database.
 func (c Core) QueryAll(ctx context.Context) ([]Location, error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.queryall")
+	defer span.End()
+
 	dbLocations, err := c.store.QueryAll(ctx)
 	if err != nil {
 		if errors.Is(err, database.ErrDBNotFound) {
@@ -107,3 +326,74 @@ func (c Core) QueryAll(ctx context.Context) ([]Location, error) {
 
 	return toLocationSlice(dbLocations), nil
 }
+
+// QueryPage gets a page of locations sorted by uuid without counting them, the
+// total of the page is zero. It is meant to read all locations page by page.
+func (c Core) QueryPage(ctx context.Context, q page.Query) (page.Page[Location], error) {
+	ctx, span := tracer.Start(ctx, "business.core.location.querypage")
+	defer span.End()
+
+	ks, err := q.Keyset(sortColumns)
+	if err != nil {
+		return page.Page[Location]{}, fmt.Errorf("%w: %s", ErrValidation, err)
+	}
+
+	dbLocations, err := c.store.Query(ctx, ks)
+	if err != nil {
+		return page.Page[Location]{}, fmt.Errorf("query: %w", err)
+	}
+
+	return page.New(toLocationSlice(dbLocations), 0, ks, sortKey), nil
+}
+
+// toDBIPRanges parses the ip ranges to their database form.
+func toDBIPRanges(ips []string) ([]db.IPRange, error) {
+	ranges := make([]db.IPRange, len(ips))
+	for i, ip := range ips {
+		r, err := ParseIPRange(ip)
+		if err != nil {
+			return nil, ErrValidation
+		}
+
+		ranges[i] = db.IPRange{
+			IPFrom: IPKey(r.From),
+			IPTo:   IPKey(r.To),
+		}
+	}
+
+	return ranges, nil
+}
+
+// encodeCursor returns the opaque cursor of the position of the location in
+// the order of a box search.
+func encodeCursor(dbLocation db.Location) string {
+	position := strconv.FormatFloat(dbLocation.Latitude, 'g', -1, 64) + "," +
+		strconv.FormatFloat(dbLocation.Longitude, 'g', -1, 64) + "," + dbLocation.UUID
+
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// decodeCursor parses the cursor made by encodeCursor.
+func decodeCursor(cursor string) (db.Cursor, error) {
+	position, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return db.Cursor{}, err
+	}
+
+	parts := strings.SplitN(string(position), ",", 3)
+	if len(parts) != 3 {
+		return db.Cursor{}, errors.New("malformed cursor")
+	}
+
+	lat, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return db.Cursor{}, err
+	}
+
+	lon, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return db.Cursor{}, err
+	}
+
+	return db.Cursor{Latitude: lat, Longitude: lon, UUID: parts[2]}, nil
+}
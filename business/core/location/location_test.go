@@ -111,5 +111,145 @@ func Test_Location(t *testing.T) {
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve all locations.", tests.Success, testID)
 
 		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen handling nested ip ranges.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+			for _, ip := range []string{"10.0.0.0/8", "10.1.0.0-10.1.255.255"} {
+				_, err := core.Create(ctx, location.NewLocation{
+					IP:           ip,
+					Longitude:    7.206435933364332,
+					Latitude:     -84.87503094689836,
+					MysteryValue: 7823011346,
+					CityUUID:     "6c1a1d32-456f-4a20-91d0-cf962c3d6d67",
+				}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create a location for %s: %s.", tests.Failed, testID, ip, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create locations for ranges.", tests.Success, testID)
+
+			lookups := map[string]string{
+				"10.1.2.3":        "10.1.0.0/16",
+				"::ffff:10.1.2.3": "10.1.0.0/16",
+				"10.2.0.1":        "10.0.0.0/8",
+				"200.106.141.15":  "200.106.141.15",
+			}
+			for ip, exp := range lookups {
+				saved, err := core.QueryByIP(ctx, ip)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve location by IP %s: %s.", tests.Failed, testID, ip, err)
+				}
+
+				if saved.IP != exp {
+					t.Fatalf("\t%s\tTest %d:\tShould get the most specific range for %s. Got %s, expected %s.", tests.Failed, testID, ip, saved.IP, exp)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the most specific range containing the ip.", tests.Success, testID)
+
+			if _, err := core.QueryByIP(ctx, "11.0.0.1"); err != location.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find an ip outside of all ranges: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find an ip outside of all ranges.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen handling IPv6 addresses in different text forms.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+			nl := location.NewLocation{
+				IP:           "2001:0db8:0000::1",
+				Longitude:    7.206435933364332,
+				Latitude:     -84.87503094689836,
+				MysteryValue: 7823011346,
+				CityUUID:     "6c1a1d32-456f-4a20-91d0-cf962c3d6d67",
+			}
+
+			created, err := core.Create(ctx, nl, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a location: %s.", tests.Failed, testID, err)
+			}
+
+			if created.IP != "2001:db8::1" {
+				t.Fatalf("\t%s\tTest %d:\tShould render the canonical ip. Got %s.", tests.Failed, testID, created.IP)
+			}
+			t.Logf("\t%s\tTest %d:\tShould render the canonical ip.", tests.Success, testID)
+
+			saved, err := core.QueryByIP(ctx, "2001:db8::0:1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve location by IP: %s.", tests.Failed, testID, err)
+			}
+
+			if diff := cmp.Diff(created, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same location. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the location by another text form of the ip.", tests.Success, testID)
+
+			nl.IP = "2001:db8::1"
+			if _, err := core.Create(ctx, nl, now); err != location.ErrDuplicate {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to create a location with the same ip: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to create a location with the same ip.", tests.Success, testID)
+		}
+
+		testID += 1
+		t.Logf("\tTest %d:\tWhen searching locations inside a box.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+			for ip, lon := range map[string]float64{"172.16.0.1": 179.5, "172.16.0.2": -179.5, "172.16.0.3": 0} {
+				_, err := core.Create(ctx, location.NewLocation{
+					IP:           ip,
+					Longitude:    lon,
+					Latitude:     10,
+					MysteryValue: 7823011346,
+					CityUUID:     "6c1a1d32-456f-4a20-91d0-cf962c3d6d67",
+				}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create a location for %s: %s.", tests.Failed, testID, ip, err)
+				}
+			}
+
+			box := location.BBox{MinLon: 179, MinLat: 9, MaxLon: -179, MaxLat: 11}
+
+			var ips []string
+			var cursor string
+			for page := 0; page == 0 || cursor != ""; page++ {
+				res, err := core.QueryByBox(ctx, box, "", cursor, 1)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to search the box: %s.", tests.Failed, testID, err)
+				}
+				if page > 2 {
+					t.Fatalf("\t%s\tTest %d:\tShould stop paging after the last location.", tests.Failed, testID)
+				}
+
+				for _, loc := range res.Locations {
+					ips = append(ips, loc.IP)
+				}
+				cursor = res.NextCursor
+			}
+
+			if diff := cmp.Diff([]string{"172.16.0.2", "172.16.0.1"}, ips); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould page through the locations across the antimeridian. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould page through the locations across the antimeridian.", tests.Success, testID)
+
+			if _, err := core.QueryByBox(ctx, box, "", "not a cursor", 1); err != location.ErrValidation {
+				t.Fatalf("\t%s\tTest %d:\tShould not accept a malformed cursor: %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not accept a malformed cursor.", tests.Success, testID)
+
+			res, err := core.QueryByBox(ctx, box, "NL", "", 10)
+			if err != nil || len(res.Locations) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not find locations of another country: %v, %v.", tests.Failed, testID, res, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find locations of another country.", tests.Success, testID)
+		}
 	}
 }
@@ -2,15 +2,15 @@ package location
 
 import (
 	"github.com/mchusovlianov/geodata/business/core/location/db"
+	"github.com/mchusovlianov/geodata/foundation/geohash"
 	"time"
-	"unsafe"
 )
 
 // Location
 type Location struct {
 	UUID         string    `json:"uuid"`          // Unique identifier.
 	CityUUID     string    `json:"city_uuid"`     // Unique identifier of the linked city.
-	IP           string    `json:"ip"`            // IP of the location.
+	IP           string    `json:"ip"`            // IP range of the location: an address, a CIDR block or "start-end".
 	Latitude     float64   `json:"latitude"`      // Latitude of the location.
 	Longitude    float64   `json:"longitude"`     // Longitude of the location.
 	MysteryValue int64     `json:"mystery_value"` // MysteryValue of the location.
@@ -20,16 +20,63 @@ type Location struct {
 
 // NewLocation is what we require from clients when adding a Location.
 type NewLocation struct {
-	IP           string  `json:"ip" validate:"required,ip"`
+	IP           string  `json:"ip" validate:"required"`
 	Longitude    float64 `json:"longitude" validate:"required"`
 	Latitude     float64 `json:"latitude" validate:"required"`
 	MysteryValue int64   `json:"mystery_value" validate:"required"`
 	CityUUID     string  `json:"city_uuid" validate:"required"`
 }
 
+// BBox is a box of coordinates. A box with MinLon greater than MaxLon crosses the
+// antimeridian.
+type BBox struct {
+	MinLon float64 // Western edge of the box.
+	MinLat float64 // Southern edge of the box.
+	MaxLon float64 // Eastern edge of the box.
+	MaxLat float64 // Northern edge of the box.
+}
+
+// LocationPage is a page of locations with the cursor of the next page, the last
+// page has none.
+type LocationPage struct {
+	Locations  []Location `json:"locations"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
 func toLocation(dbLocation db.Location) Location {
-	ci := (*Location)(unsafe.Pointer(&dbLocation))
-	return *ci
+	return Location{
+		UUID:         dbLocation.UUID,
+		CityUUID:     dbLocation.CityUUID,
+		IP:           toIPRange(dbLocation.IPFrom, dbLocation.IPTo).String(),
+		Latitude:     dbLocation.Latitude,
+		Longitude:    dbLocation.Longitude,
+		MysteryValue: dbLocation.MysteryValue,
+		DateCreated:  dbLocation.DateCreated,
+		DateUpdated:  dbLocation.DateUpdated,
+	}
+}
+
+// toDBLocation converts a new location with a parsed ip range to its database
+// form.
+func toDBLocation(location NewLocation, r IPRange, locationUUID string, now time.Time) db.Location {
+	return db.Location{
+		UUID:         locationUUID,
+		CityUUID:     location.CityUUID,
+		IPFrom:       IPKey(r.From),
+		IPTo:         IPKey(r.To),
+		IPSpan:       db.IPSpan(IPKey(r.From), IPKey(r.To)),
+		Longitude:    location.Longitude,
+		Latitude:     location.Latitude,
+		Geohash:      geohash.Encode(location.Latitude, location.Longitude, geohash.MaxPrecision),
+		MysteryValue: location.MysteryValue,
+		DateCreated:  now,
+		DateUpdated:  now,
+	}
+}
+
+// sortKey returns the cursor key of locations sorted by uuid.
+func sortKey(l Location) (string, string) {
+	return l.UUID, l.UUID
 }
 
 func toLocationSlice(dbCities []db.Location) []Location {
@@ -39,3 +86,9 @@ func toLocationSlice(dbCities []db.Location) []Location {
 	}
 	return cis
 }
+
+// FromDB converts a location read by the store of another core, like a joined
+// query, to its business form.
+func FromDB(dbLocation db.Location) Location {
+	return toLocation(dbLocation)
+}
@@ -75,3 +75,145 @@ ALTER TABLE locations
 -- Description: Add index for location_ip field
 ALTER TABLE locations
     ADD UNIQUE INDEX index_ip (ip);
+
+-- Version: 2.1
+-- Description: Create table generations
+CREATE TABLE generations
+(
+    id           BIGINT AUTO_INCREMENT,
+    action       VARCHAR(16),
+    date_created DATETIME,
+
+    PRIMARY KEY (id)
+);
+
+-- Version: 2.2
+-- Description: Create table import_runs
+CREATE TABLE import_runs
+(
+    uuid         VARCHAR(36),
+    file_name    VARCHAR(255),
+    checksum     VARCHAR(64),
+    status       VARCHAR(16),
+    line         INT,
+    good_lines   INT,
+    failed_lines INT,
+    date_created DATETIME,
+    date_updated DATETIME,
+
+    PRIMARY KEY (uuid)
+);
+
+-- Version: 2.3
+-- Description: Add index for date_created field
+ALTER TABLE import_runs
+    ADD INDEX index_date_created (date_created);
+
+-- Version: 2.4
+-- Description: Add result fields to import_runs
+ALTER TABLE import_runs
+    ADD COLUMN total_lines   INT           NOT NULL DEFAULT 0,
+    ADD COLUMN inserted      INT           NOT NULL DEFAULT 0,
+    ADD COLUMN updated       INT           NOT NULL DEFAULT 0,
+    ADD COLUMN unchanged     INT           NOT NULL DEFAULT 0,
+    ADD COLUMN deleted       INT           NOT NULL DEFAULT 0,
+    ADD COLUMN error         VARCHAR(1024) NOT NULL DEFAULT '',
+    ADD COLUMN date_finished DATETIME      NULL;
+
+-- Version: 2.5
+-- Description: Add ip range fields to locations
+ALTER TABLE locations
+    MODIFY COLUMN ip VARCHAR(81), -- canonical text of a range: an address, a CIDR block or "start-end"
+    ADD COLUMN ip_from VARBINARY(16),
+    ADD COLUMN ip_to   VARBINARY(16);
+
+-- Version: 2.6
+-- Description: Fill ip range fields of existing locations, IPv4 addresses are mapped to IPv6 ones
+UPDATE locations
+SET ip_from = IF(IS_IPV4(ip), CONCAT(UNHEX('00000000000000000000FFFF'), INET6_ATON(ip)), INET6_ATON(ip)),
+    ip_to   = IF(IS_IPV4(ip), CONCAT(UNHEX('00000000000000000000FFFF'), INET6_ATON(ip)), INET6_ATON(ip));
+
+-- Version: 2.7
+-- Description: Add index for ip range lookups
+ALTER TABLE locations
+    ADD INDEX index_ip_from_ip_to (ip_from, ip_to);
+
+-- Version: 2.8
+-- Description: Delete locations with an ip range stored before under another text form, keep the oldest one
+DELETE l1
+FROM locations AS l1
+    JOIN locations AS l2
+    ON l1.ip_from = l2.ip_from AND l1.ip_to = l2.ip_to AND
+       (l1.date_created > l2.date_created OR (l1.date_created = l2.date_created AND l1.uuid > l2.uuid));
+
+-- Version: 2.9
+-- Description: Make binary ip ranges the only key of locations
+ALTER TABLE locations
+    DROP INDEX index_ip,
+    DROP INDEX index_city_uuid_ip_latitude_longitude,
+    DROP INDEX index_ip_from_ip_to,
+    MODIFY COLUMN ip_from VARBINARY(16) NOT NULL,
+    MODIFY COLUMN ip_to VARBINARY(16) NOT NULL,
+    ADD UNIQUE INDEX index_ip_from_ip_to (ip_from, ip_to),
+    DROP COLUMN ip;
+
+-- Version: 3
+-- Description: Add geohash of the coordinates to locations for nearby searches
+ALTER TABLE locations
+    ADD COLUMN geohash CHAR(12) CHARACTER SET ascii NOT NULL DEFAULT '';
+
+-- Version: 3.1
+-- Description: Fill geohashes of existing locations
+UPDATE locations
+SET geohash = ST_GeoHash(longitude, latitude, 12);
+
+-- Version: 3.2
+-- Description: Add index for searches by geohash prefixes
+ALTER TABLE locations
+    ADD INDEX index_geohash (geohash);
+
+-- Version: 3.3
+-- Description: Add index for searches inside boxes of coordinates
+ALTER TABLE locations
+    ADD INDEX index_latitude_longitude (latitude, longitude);
+
+-- Version: 3.4
+-- Description: Add index for pages of all cities sorted by name
+ALTER TABLE cities
+    ADD INDEX index_name (name);
+
+-- Version: 3.5
+-- Description: Create table dataset_generation holding the generation of the dataset tables next to them
+CREATE TABLE dataset_generation
+(
+    generation_id BIGINT NOT NULL,
+
+    PRIMARY KEY (generation_id)
+);
+
+-- Version: 3.6
+-- Description: Fill the generation of the live dataset
+INSERT INTO dataset_generation (generation_id)
+SELECT id FROM generations ORDER BY id DESC LIMIT 1;
+
+-- Version: 3.7
+-- Description: Add span of the ip range to locations for lookups reading only the blocks which may contain an address
+ALTER TABLE locations
+    ADD COLUMN ip_span TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER ip_to;
+
+-- Version: 3.8
+-- Description: Fill spans of existing locations: the bit length of ip_from XOR ip_to
+UPDATE locations
+SET ip_span = IF(ip_from = ip_to, 0,
+    (LENGTH(TRIM(LEADING UNHEX('00') FROM (ip_from ^ ip_to))) - 1) * 8 +
+    LENGTH(BIN(ASCII(TRIM(LEADING UNHEX('00') FROM (ip_from ^ ip_to))))));
+
+-- Version: 3.9
+-- Description: Add index for lookups by ip within the blocks of the spans
+ALTER TABLE locations
+    ADD INDEX index_ip_span_ip_from (ip_span, ip_from);
+
+-- Version: 4
+-- Description: Add the generation of the staging tables a run imports into
+ALTER TABLE import_runs
+    ADD COLUMN generation_id BIGINT NOT NULL DEFAULT 0 AFTER checksum;
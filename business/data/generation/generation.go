@@ -0,0 +1,368 @@
+// Package generation manages generations of the imported dataset. An import is
+// loaded into a staging schema and promoted to the live schema with a single
+// atomic RENAME TABLE, so readers see either the old or the new dataset. The
+// replaced tables are kept in a previous schema to allow a rollback. The id of
+// a generation is kept in a table renamed together with the dataset, so a reader
+// never sees the tables of one generation under the id of another, and an
+// import can tell the staging tables it filled from ones which replaced them.
+package generation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mchusovlianov/geodata/foundation/database"
+)
+
+// Suffixes of the schemas holding the staging and the previous generation. They
+// are appended to the name of the live schema.
+const (
+	StagingSuffix  = "_staging"
+	PreviousSuffix = "_previous"
+)
+
+// Set of actions which create a generation.
+const (
+	ActionStage    = "stage"
+	ActionPromote  = "promote"
+	ActionRollback = "rollback"
+)
+
+// Set of error variables for generation operations.
+var (
+	ErrNoPrevious = errors.New("previous generation not found")
+	ErrNotFound   = errors.New("generation not found")
+)
+
+// markTable is the table keeping the id of the generation of the dataset.
+const markTable = "dataset_generation"
+
+// tables lists the tables which form a generation of the dataset.
+var tables = []string{"countries", "cities", "locations", markTable}
+
+// Generation represents a dataset which was staged or made current.
+type Generation struct {
+	ID          int64     `db:"id"`           // Unique identifier.
+	Action      string    `db:"action"`       // How the generation was created.
+	DateCreated time.Time `db:"date_created"` // When the generation was created.
+}
+
+// Stage creates empty dataset tables in the staging schema with the same
+// structure as the live ones and records them as a new generation. Tables left
+// by a previous import are dropped.
+func Stage(ctx context.Context, db *sqlx.DB, now time.Time) (Generation, error) {
+	live, err := schemaName(ctx, db)
+	if err != nil {
+		return Generation{}, err
+	}
+	staging := live + StagingSuffix
+
+	gen, err := create(ctx, db, ActionStage, now)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	queries := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", staging),
+		dropTables(staging),
+	}
+	for _, table := range tables {
+		queries = append(queries, fmt.Sprintf("CREATE TABLE `%s`.`%s` LIKE `%s`.`%s`", staging, table, live, table))
+	}
+	queries = append(queries, mark(staging, live, gen.ID)...)
+
+	if err := execAll(ctx, db, queries); err != nil {
+		return Generation{}, fmt.Errorf("staging generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// StageCopy creates dataset tables in the staging schema like Stage does and
+// fills them with the live records, so an import can apply changes to them.
+func StageCopy(ctx context.Context, db *sqlx.DB, now time.Time) (Generation, error) {
+	gen, err := Stage(ctx, db, now)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	live, err := schemaName(ctx, db)
+	if err != nil {
+		return Generation{}, err
+	}
+	staging := live + StagingSuffix
+
+	queries := make([]string, 0, len(tables))
+	for _, table := range tables {
+		if table == markTable {
+			continue
+		}
+		queries = append(queries, fmt.Sprintf("INSERT INTO `%s`.`%s` SELECT * FROM `%s`.`%s`", staging, table, live, table))
+	}
+
+	if err := execAll(ctx, db, queries); err != nil {
+		return Generation{}, fmt.Errorf("copying generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// Promote makes the staging tables live. The live tables are moved to the
+// previous schema in the same statement, replacing an older previous
+// generation.
+func Promote(ctx context.Context, db *sqlx.DB, now time.Time) (Generation, error) {
+	live, err := schemaName(ctx, db)
+	if err != nil {
+		return Generation{}, err
+	}
+	staging := live + StagingSuffix
+	previous := live + PreviousSuffix
+
+	gen, err := create(ctx, db, ActionPromote, now)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	renames := make([]string, 0, 2*len(tables))
+	for _, table := range tables {
+		renames = append(renames,
+			fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", live, table, previous, table),
+			fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", staging, table, live, table),
+		)
+	}
+
+	queries := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", previous),
+		dropTables(previous),
+	}
+	queries = append(queries, mark(staging, live, gen.ID)...)
+	queries = append(queries, "RENAME TABLE "+strings.Join(renames, ", "))
+
+	if err := execAll(ctx, db, queries); err != nil {
+		return Generation{}, fmt.Errorf("promoting generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// Rollback makes the previous generation live again. The replaced live tables
+// are moved back to the staging schema.
+func Rollback(ctx context.Context, db *sqlx.DB, now time.Time) (Generation, error) {
+	live, err := schemaName(ctx, db)
+	if err != nil {
+		return Generation{}, err
+	}
+	staging := live + StagingSuffix
+	previous := live + PreviousSuffix
+
+	// a previous generation promoted before its id was kept with the tables
+	// lacks the mark table, mark creates it.
+	ok, err := hasTables(ctx, db, previous, markTable)
+	if err != nil {
+		return Generation{}, fmt.Errorf("reading previous tables: %w", err)
+	}
+	if !ok {
+		return Generation{}, ErrNoPrevious
+	}
+
+	gen, err := create(ctx, db, ActionRollback, now)
+	if err != nil {
+		return Generation{}, err
+	}
+
+	renames := make([]string, 0, 2*len(tables))
+	for _, table := range tables {
+		renames = append(renames,
+			fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", live, table, staging, table),
+			fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", previous, table, live, table),
+		)
+	}
+
+	queries := []string{
+		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", staging),
+		dropTables(staging),
+	}
+	queries = append(queries, mark(previous, live, gen.ID)...)
+	queries = append(queries, "RENAME TABLE "+strings.Join(renames, ", "))
+
+	if err := execAll(ctx, db, queries); err != nil {
+		return Generation{}, fmt.Errorf("rolling back generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// QueryCurrent gets the generation which is live right now. It is the one of
+// the live dataset tables, a generation recorded by a promote which failed
+// afterwards never becomes current.
+func QueryCurrent(ctx context.Context, db *sqlx.DB) (Generation, error) {
+	const q = `
+	SELECT
+		g.*
+	FROM
+		dataset_generation AS d
+	JOIN
+		generations AS g ON g.id = d.generation_id
+	LIMIT 1`
+
+	var gen Generation
+	if err := database.NamedQueryStruct(ctx, db, q, struct{}{}, &gen); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Generation{}, ErrNotFound
+		}
+		return Generation{}, fmt.Errorf("selecting current generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// QueryStaged gets the generation of the staging tables. An import staged them
+// as a generation of its own, a promote moves them away and a rollback replaces
+// them with the tables of another generation.
+func QueryStaged(ctx context.Context, db *sqlx.DB) (Generation, error) {
+	live, err := schemaName(ctx, db)
+	if err != nil {
+		return Generation{}, err
+	}
+	staging := live + StagingSuffix
+
+	ok, err := hasTables(ctx, db, staging, "")
+	if err != nil {
+		return Generation{}, fmt.Errorf("reading staging tables: %w", err)
+	}
+	if !ok {
+		return Generation{}, ErrNotFound
+	}
+
+	table := fmt.Sprintf("`%s`.`%s`", staging, markTable)
+	q := fmt.Sprintf(`
+	SELECT
+		g.*
+	FROM
+		%s AS d
+	JOIN
+		generations AS g ON g.id = d.generation_id
+	LIMIT 1`, table)
+
+	var gen Generation
+	if err := database.NamedQueryStruct(ctx, db, q, struct{}{}, &gen); err != nil {
+		if errors.Is(err, database.ErrDBNotFound) {
+			return Generation{}, ErrNotFound
+		}
+		return Generation{}, fmt.Errorf("selecting staged generation: %w", err)
+	}
+
+	return gen, nil
+}
+
+// create records a generation which is about to become current.
+func create(ctx context.Context, db *sqlx.DB, action string, now time.Time) (Generation, error) {
+	const q = `
+	INSERT INTO generations
+		(action, date_created)
+	VALUES
+		(?, ?)`
+
+	res, err := db.ExecContext(ctx, q, action, now)
+	if err != nil {
+		return Generation{}, fmt.Errorf("inserting generation: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Generation{}, fmt.Errorf("reading generation id: %w", err)
+	}
+
+	return Generation{
+		ID:          id,
+		Action:      action,
+		DateCreated: now,
+	}, nil
+}
+
+// mark returns the queries making the generation the one of the dataset
+// tables of the schema. The schema isn't live, so readers never see them apart.
+// Tables staged or promoted before the generation was kept with them get the
+// table too.
+func mark(schema string, live string, id int64) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` LIKE `%s`.`%s`", schema, markTable, live, markTable),
+		fmt.Sprintf("DELETE FROM `%s`.`%s`", schema, markTable),
+		fmt.Sprintf("INSERT INTO `%s`.`%s` (generation_id) VALUES (%d)", schema, markTable, id),
+	}
+}
+
+// hasTables tells if the schema has all dataset tables but the optional one.
+func hasTables(ctx context.Context, db *sqlx.DB, schema string, optional string) (bool, error) {
+	data := struct {
+		Schema   string `db:"schema_name"`
+		Optional string `db:"optional"`
+	}{
+		Schema:   schema,
+		Optional: optional,
+	}
+
+	const q = `
+	SELECT
+		table_name AS name
+	FROM
+		information_schema.tables
+	WHERE
+		table_schema = :schema_name AND
+		table_name <> :optional`
+
+	var names []struct {
+		Name string `db:"name"`
+	}
+	if err := database.NamedQuerySlice(ctx, db, q, data, &names); err != nil {
+		return false, err
+	}
+
+	found := make(map[string]bool, len(names))
+	for _, n := range names {
+		found[n.Name] = true
+	}
+	for _, table := range tables {
+		if table != optional && !found[table] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// schemaName returns the name of the schema the connection works with.
+func schemaName(ctx context.Context, db *sqlx.DB) (string, error) {
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&name); err != nil {
+		return "", fmt.Errorf("selecting schema name: %w", err)
+	}
+
+	return name, nil
+}
+
+// dropTables returns a query dropping the dataset tables of the schema.
+func dropTables(schema string) string {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = fmt.Sprintf("`%s`.`%s`", schema, table)
+	}
+
+	return "DROP TABLE IF EXISTS " + strings.Join(names, ", ")
+}
+
+// execAll executes the queries one by one. DDL statements commit implicitly in
+// mysql, so there is no point to wrap them into a transaction.
+func execAll(ctx context.Context, db *sqlx.DB, queries []string) error {
+	for _, q := range queries {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// Package page provides keyset pagination of lists. A page starts right after
+// the last item of the previous one, so deep pages are as fast as the first one
+// and items added meanwhile don't shift them.
+package page
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxLimit is the largest number of items on a page.
+const MaxLimit = 1000
+
+// ErrInvalid is returned for a query with an unknown sort field, a limit out of
+// range or a malformed cursor.
+var ErrInvalid = errors.New("invalid page query")
+
+// Query asks for a page of a list sorted by one of its fields.
+type Query struct {
+	Sort   string // Field to sort by, a leading '-' sorts in descending order.
+	Cursor string // Cursor of the page, the first page if empty.
+	Limit  int    // Largest number of items on the page.
+}
+
+// ParseQuery reads a query from the sort, cursor and limit parameters. Missing
+// ones get the default sort field and limit.
+func ParseQuery(values url.Values, defaultSort string, defaultLimit int) (Query, error) {
+	q := Query{
+		Sort:   values.Get("sort"),
+		Cursor: values.Get("cursor"),
+		Limit:  defaultLimit,
+	}
+
+	if q.Sort == "" {
+		q.Sort = defaultSort
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid limit format: %s", value)
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// Page is a page of a list with the total number of items and the cursor of the
+// next page, the last page has none.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the position of the last item of a page: its sort value and uuid,
+// which breaks ties of equal sort values.
+type Cursor struct {
+	Value string
+	UUID  string
+}
+
+// Keyset is a validated query for a store. It asks for one item over the limit
+// of the page to tell whether there is a next page.
+type Keyset struct {
+	Column string  // Column to sort by.
+	Desc   bool    // Sort in descending order.
+	After  *Cursor // Position the page starts after, nil for the first page.
+	Limit  int     // Number of items to read.
+}
+
+// Keyset validates the query against the sortable fields mapped to their
+// columns.
+func (q Query) Keyset(columns map[string]string) (Keyset, error) {
+	field, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+
+	column, ok := columns[field]
+	if !ok {
+		return Keyset{}, fmt.Errorf("%w: unknown sort field %q", ErrInvalid, field)
+	}
+
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return Keyset{}, fmt.Errorf("%w: limit must be within [1, %d]", ErrInvalid, MaxLimit)
+	}
+
+	ks := Keyset{
+		Column: column,
+		Desc:   desc,
+		Limit:  q.Limit + 1,
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Keyset{}, fmt.Errorf("%w: malformed cursor", ErrInvalid)
+		}
+		ks.After = &after
+	}
+
+	return ks, nil
+}
+
+// Where returns the condition selecting the items after the cursor, true for
+// the first page. The cursor is bound as :after_value and :after_uuid.
+func (ks Keyset) Where(uuidColumn string) string {
+	if ks.After == nil {
+		return "TRUE"
+	}
+
+	op := ">"
+	if ks.Desc {
+		op = "<"
+	}
+
+	return fmt.Sprintf("(%[1]s %[2]s :after_value OR (%[1]s = :after_value AND %[3]s %[2]s :after_uuid))", ks.Column, op, uuidColumn)
+}
+
+// OrderBy returns the order of the items, ties are ordered by uuid.
+func (ks Keyset) OrderBy(uuidColumn string) string {
+	dir := "ASC"
+	if ks.Desc {
+		dir = "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, %s %s", ks.Column, dir, uuidColumn, dir)
+}
+
+// Args adds the cursor and the limit to the arguments of a named query.
+func (ks Keyset) Args(args map[string]any) map[string]any {
+	args["limit"] = ks.Limit
+	if ks.After != nil {
+		args["after_value"] = ks.After.Value
+		args["after_uuid"] = ks.After.UUID
+	}
+
+	return args
+}
+
+// New makes the page of the items read by the keyset. The key returns the sort
+// value and the uuid of an item.
+func New[T any](items []T, total int, ks Keyset, key func(T) (string, string)) Page[T] {
+	p := Page[T]{
+		Items: items,
+		Total: total,
+	}
+
+	// the item over the limit tells there is a next page
+	if limit := ks.Limit - 1; len(items) > limit {
+		p.Items = items[:limit]
+
+		value, uuid := key(p.Items[limit-1])
+		p.NextCursor = encodeCursor(Cursor{Value: value, UUID: uuid})
+	}
+
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+
+	return p
+}
+
+// encodeCursor returns the opaque form of the cursor.
+func encodeCursor(c Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.UUID + "," + c.Value))
+}
+
+// decodeCursor parses the cursor made by encodeCursor.
+func decodeCursor(cursor string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, err
+	}
+
+	uuid, value, ok := strings.Cut(string(b), ",")
+	if !ok {
+		return Cursor{}, errors.New("malformed cursor")
+	}
+
+	return Cursor{Value: value, UUID: uuid}, nil
+}
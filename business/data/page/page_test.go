@@ -0,0 +1,142 @@
+package page_test
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mchusovlianov/geodata/business/data/page"
+	"github.com/mchusovlianov/geodata/business/data/tests"
+	"strings"
+	"testing"
+)
+
+// item is a sorted item, its uuid breaks ties of equal names.
+type item struct {
+	Name string
+	UUID string
+}
+
+func Test_Keyset(t *testing.T) {
+	columns := map[string]string{"name": "name"}
+
+	t.Log("Given the need to validate page queries.")
+	{
+		for testID, q := range []page.Query{
+			{Sort: "code", Limit: 10},
+			{Sort: "name", Limit: 0},
+			{Sort: "name", Limit: page.MaxLimit + 1},
+			{Sort: "name", Cursor: "!", Limit: 10},
+			{Sort: "name", Cursor: "bm8tY29tbWE", Limit: 10},
+		} {
+			t.Logf("\tTest %d:\tWhen using the query %+v.", testID, q)
+			{
+				if _, err := q.Keyset(columns); !errors.Is(err, page.ErrInvalid) {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to validate the query: %v.", tests.Failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not be able to validate the query.", tests.Success, testID)
+			}
+		}
+	}
+
+	t.Log("Given the need to page through items with equal sort values.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reading pages of 2 items in descending order.", testID)
+		{
+			// sorted by -name and then -uuid, as a store would read them
+			all := []item{{"b", "3"}, {"a,b", "9"}, {"a,b", "8"}, {"a", "2"}, {"a", "1"}}
+
+			q := page.Query{Sort: "-name", Limit: 2}
+			var got []item
+			for pages := 0; ; pages++ {
+				if pages > len(all) {
+					t.Fatalf("\t%s\tTest %d:\tShould reach the last page.", tests.Failed, testID)
+				}
+
+				ks, err := q.Keyset(columns)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to validate the query: %v.", tests.Failed, testID, err)
+				}
+				if !ks.Desc || ks.Column != "name" || ks.Limit != 3 {
+					t.Fatalf("\t%s\tTest %d:\tShould read one item over the limit in descending order. Got %+v.", tests.Failed, testID, ks)
+				}
+
+				p := page.New(read(all, ks), len(all), ks, func(i item) (string, string) { return i.Name, i.UUID })
+				got = append(got, p.Items...)
+
+				if p.NextCursor == "" {
+					break
+				}
+				q.Cursor = p.NextCursor
+			}
+
+			if diff := cmp.Diff(all, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get every item once in order. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get every item once in order.", tests.Success, testID)
+		}
+	}
+}
+
+// read mimics a store: it skips the items up to the cursor of the keyset and
+// returns up to its limit of the next ones.
+func read(all []item, ks page.Keyset) []item {
+	start := 0
+	if ks.After != nil {
+		for start < len(all) {
+			i := all[start]
+			start++
+			if i.Name == ks.After.Value && i.UUID == ks.After.UUID {
+				break
+			}
+		}
+	}
+
+	end := start + ks.Limit
+	if end > len(all) {
+		end = len(all)
+	}
+
+	return all[start:end]
+}
+
+func Test_Where(t *testing.T) {
+	t.Log("Given the need to select the items after a cursor.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reading the first page.", testID)
+		{
+			ks, _ := page.Query{Sort: "name", Limit: 1}.Keyset(map[string]string{"name": "c.name"})
+			if where := ks.Where("c.uuid"); where != "TRUE" {
+				t.Fatalf("\t%s\tTest %d:\tShould select all items. Got %s.", tests.Failed, testID, where)
+			}
+			if args := ks.Args(map[string]any{}); len(args) != 1 || args["limit"] != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould bind only the limit. Got %v.", tests.Failed, testID, args)
+			}
+			t.Logf("\t%s\tTest %d:\tShould select all items.", tests.Success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen reading the next page.", testID)
+		{
+			first, _ := page.Query{Sort: "name", Limit: 1}.Keyset(map[string]string{"name": "c.name"})
+			p := page.New([]item{{"a", "1"}, {"b", "2"}}, 2, first, func(i item) (string, string) { return i.Name, i.UUID })
+
+			ks, err := page.Query{Sort: "-name", Cursor: p.NextCursor, Limit: 1}.Keyset(map[string]string{"name": "c.name"})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the query: %v.", tests.Failed, testID, err)
+			}
+
+			where := ks.Where("c.uuid")
+			if !strings.Contains(where, "c.name < :after_value") || !strings.Contains(where, "c.uuid < :after_uuid") {
+				t.Fatalf("\t%s\tTest %d:\tShould select the items before the cursor. Got %s.", tests.Failed, testID, where)
+			}
+			if orderBy := ks.OrderBy("c.uuid"); orderBy != "c.name DESC, c.uuid DESC" {
+				t.Fatalf("\t%s\tTest %d:\tShould order by name and uuid. Got %s.", tests.Failed, testID, orderBy)
+			}
+			if args := ks.Args(map[string]any{}); args["after_value"] != "a" || args["after_uuid"] != "1" {
+				t.Fatalf("\t%s\tTest %d:\tShould bind the cursor. Got %v.", tests.Failed, testID, args)
+			}
+			t.Logf("\t%s\tTest %d:\tShould select the items before the cursor.", tests.Success, testID)
+		}
+	}
+}
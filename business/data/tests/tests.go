@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/mchusovlianov/geodata/business/data/dbschema"
+	"github.com/mchusovlianov/geodata/business/data/generation"
 	"github.com/mchusovlianov/geodata/foundation/database"
 	"github.com/mchusovlianov/geodata/foundation/docker"
 	"go.uber.org/zap/zapcore"
@@ -52,8 +53,9 @@ func newLogger() (*zap.SugaredLogger, error) {
 
 // NewUnit creates a test database inside a Docker container. It creates the
 // required table structure but the database is otherwise empty. It returns
-// the database to use as well as a function to call at the end of the test.
-func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func()) {
+// the database and its staging schema to use as well as a function to call at
+// the end of the test.
+func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, *sqlx.DB, func()) {
 	r, w, _ := os.Pipe()
 	old := os.Stdout
 	os.Stdout = w
@@ -90,6 +92,16 @@ func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func(
 		t.Fatalf("Opening database connection: %v", err)
 	}
 
+	stagingDB, err := database.Open(database.Config{
+		User:     "root",
+		Password: "root",
+		Host:     c.Host,
+		Name:     dbc.Name + generation.StagingSuffix,
+	})
+	if err != nil {
+		t.Fatalf("Opening staging database connection: %v", err)
+	}
+
 	t.Log("Waiting for database to be ready ...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -118,6 +130,7 @@ func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func(
 	// with the database.
 	teardown := func() {
 		t.Helper()
+		stagingDB.Close()
 		db.Close()
 		docker.StopContainer(c.ID)
 
@@ -132,27 +145,29 @@ func NewUnit(t *testing.T, dbc DBContainer) (*zap.SugaredLogger, *sqlx.DB, func(
 		fmt.Println("******************** LOGS ********************")
 	}
 
-	return log, db, teardown
+	return log, db, stagingDB, teardown
 }
 
 // Test owns state for running and shutting down tests.
 type Test struct {
-	DB       *sqlx.DB
-	Log      *zap.SugaredLogger
-	Teardown func()
+	DB        *sqlx.DB
+	StagingDB *sqlx.DB
+	Log       *zap.SugaredLogger
+	Teardown  func()
 
 	t *testing.T
 }
 
 // NewIntegration creates a database, seeds it, constructs an authenticator.
 func NewIntegration(t *testing.T, dbc DBContainer) *Test {
-	log, db, teardown := NewUnit(t, dbc)
+	log, db, stagingDB, teardown := NewUnit(t, dbc)
 
 	test := Test{
-		DB:       db,
-		Log:      log,
-		t:        t,
-		Teardown: teardown,
+		DB:        db,
+		StagingDB: stagingDB,
+		Log:       log,
+		t:         t,
+		Teardown:  teardown,
 	}
 
 	return &test
@@ -7,15 +7,24 @@ import (
 	"fmt"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/foundation/database")
+
 // Set of error variables for CRUD operations.
 var (
 	ErrDBNotFound        = errors.New("not found")
 	ErrDBDuplicatedEntry = errors.New("duplicated entry")
 )
 
+// maxStatementLen bounds the length of the SQL recorded with a span.
+const maxStatementLen = 4096
+
 // Config is the required properties to use the database.
 type Config struct {
 	User         string
@@ -74,6 +83,9 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 // NamedExecContext is a helper function to execute a CUD operation with
 // logging and tracing.
 func NamedExecContext(ctx context.Context, db sqlx.ExtContext, query string, data any) error {
+	ctx, span := startSpan(ctx, "foundation.database.exec", query)
+	defer span.End()
+
 	if _, err := sqlx.NamedExecContext(ctx, db, query, data); err != nil {
 		var mysqlErr *mysql.MySQLError
 		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
@@ -88,6 +100,9 @@ func NamedExecContext(ctx context.Context, db sqlx.ExtContext, query string, dat
 // NamedQuerySlice is a helper function for executing queries that return a
 // collection of data to be unmarshalled into a slice.
 func NamedQuerySlice[T any](ctx context.Context, db sqlx.ExtContext, query string, data any, dest *[]T) error {
+	ctx, span := startSpan(ctx, "foundation.database.queryslice", query)
+	defer span.End()
+
 	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
 	if err != nil {
 		return err
@@ -107,9 +122,78 @@ func NamedQuerySlice[T any](ctx context.Context, db sqlx.ExtContext, query strin
 	return nil
 }
 
+// QuerySlice is a helper function for executing queries with positional
+// arguments that return a collection of data to be unmarshalled into a slice.
+// Use this if the query is built at runtime.
+func QuerySlice[T any](ctx context.Context, db sqlx.ExtContext, query string, args []any, dest *[]T) error {
+	ctx, span := startSpan(ctx, "foundation.database.queryslice", query)
+	defer span.End()
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var slice []T
+	for rows.Next() {
+		v := new(T)
+		if err := rows.StructScan(v); err != nil {
+			return err
+		}
+		slice = append(slice, *v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	*dest = slice
+
+	return nil
+}
+
+// NamedQuerySliceUsingIn is a helper function for executing queries that return
+// a collection of data to be unmarshalled into a slice where field replacement
+// is necessary. Use this if the query has an IN clause.
+func NamedQuerySliceUsingIn[T any](ctx context.Context, db sqlx.ExtContext, query string, data any, dest *[]T) error {
+	ctx, span := startSpan(ctx, "foundation.database.querysliceusingin", query)
+	defer span.End()
+
+	named, args, err := sqlx.Named(query, data)
+	if err != nil {
+		return err
+	}
+
+	query, args, err = sqlx.In(named, args...)
+	if err != nil {
+		return err
+	}
+	query = db.Rebind(query)
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var slice []T
+	for rows.Next() {
+		v := new(T)
+		if err := rows.StructScan(v); err != nil {
+			return err
+		}
+		slice = append(slice, *v)
+	}
+	*dest = slice
+
+	return nil
+}
+
 // NamedQueryStruct is a helper function for executing queries that return a
 // single value to be unmarshalled into a struct type.
 func NamedQueryStruct(ctx context.Context, db sqlx.ExtContext, query string, data any, dest any) error {
+	ctx, span := startSpan(ctx, "foundation.database.querystruct", query)
+	defer span.End()
+
 	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
 	if err != nil {
 		return err
@@ -126,3 +210,16 @@ func NamedQueryStruct(ctx context.Context, db sqlx.ExtContext, query string, dat
 
 	return nil
 }
+
+// startSpan starts the span of a call to the database with its SQL, the caller
+// has to end it. Long statements, like lookups of many ips, are cut.
+func startSpan(ctx context.Context, name string, query string) (context.Context, trace.Span) {
+	if len(query) > maxStatementLen {
+		query = query[:maxStatementLen] + "..."
+	}
+
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(semconv.DBSystemMySQL, semconv.DBStatementKey.String(query))
+
+	return ctx, span
+}
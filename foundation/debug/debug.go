@@ -0,0 +1,24 @@
+// Package debug provides the routes of a debug listener: profiles of the
+// running program and the variables it publishes.
+package debug
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// Mux registers the standard library debug routes, /debug/pprof and
+// /debug/vars, on a mux of their own to be served by a dedicated listener.
+func Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return mux
+}
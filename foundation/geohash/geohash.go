@@ -0,0 +1,152 @@
+// Package geohash encodes positions as geohashes and measures distances between
+// them. Positions close to each other mostly share a prefix of their geohashes,
+// so a prefix search finds the positions of a cell.
+package geohash
+
+import (
+	"math"
+	"strings"
+)
+
+// MaxPrecision is the length of the most precise geohash, its cells are a few
+// centimetres wide.
+const MaxPrecision = 12
+
+// EarthRadiusKm is the mean radius of the earth.
+const EarthRadiusKm = 6371.0088
+
+// base32 is the alphabet of geohashes.
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Encode returns the geohash of the position with the given number of characters.
+func Encode(lat, lon float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+
+	var b strings.Builder
+	b.Grow(precision)
+
+	even := true
+	for b.Len() < precision {
+		var ch int
+		for bit := 4; bit >= 0; bit-- {
+			if even {
+				mid := (minLon + maxLon) / 2
+				if lon >= mid {
+					ch |= 1 << bit
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if lat >= mid {
+					ch |= 1 << bit
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+		b.WriteByte(base32[ch])
+	}
+
+	return b.String()
+}
+
+// Decode returns the center of the cell of the geohash. Invalid characters stop
+// the decoding.
+func Decode(hash string) (lat, lon float64) {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(base32, hash[i])
+		if ch < 0 {
+			break
+		}
+
+		for bit := 4; bit >= 0; bit-- {
+			on := ch&(1<<bit) != 0
+			if even {
+				mid := (minLon + maxLon) / 2
+				if on {
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if on {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+
+	return (minLat + maxLat) / 2, (minLon + maxLon) / 2
+}
+
+// CellSize returns the height and the width in degrees of the cells of geohashes
+// with the given number of characters.
+func CellSize(precision int) (lat, lon float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// Neighbours returns the geohashes of the cells around the cell of the geohash.
+// Longitudes wrap around the antimeridian, there are no cells beyond the poles.
+func Neighbours(hash string) []string {
+	lat, lon := Decode(hash)
+	height, width := CellSize(len(hash))
+
+	neighbours := make([]string, 0, 8)
+	seen := map[string]bool{hash: true}
+	for _, dLat := range []float64{-height, 0, height} {
+		nLat := lat + dLat
+		if nLat < -90 || nLat > 90 {
+			continue
+		}
+
+		for _, dLon := range []float64{-width, 0, width} {
+			nLon := lon + dLon
+			switch {
+			case nLon < -180:
+				nLon += 360
+			case nLon >= 180:
+				nLon -= 360
+			}
+
+			n := Encode(nLat, nLon, len(hash))
+			if !seen[n] {
+				seen[n] = true
+				neighbours = append(neighbours, n)
+			}
+		}
+	}
+
+	return neighbours
+}
+
+// Distance returns the great-circle distance in kilometres between positions
+// given in degrees.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi, dLambda := radians(lat2-lat1), radians(lon2-lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// radians converts degrees to radians.
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,110 @@
+package geohash_test
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/mchusovlianov/geodata/foundation/geohash"
+	"math"
+	"sort"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func Test_Geohash(t *testing.T) {
+	t.Log("Given the need to encode and decode positions.")
+	{
+		for testID, tt := range []struct {
+			lat, lon float64
+			hash     string
+		}{
+			{57.64911, 10.40744, "u4pruydqqvj"},
+			{42.6, -5.6, "ezs42"},
+			{-25.382708, -49.265506, "6gkzwgjzn820"},
+			{0, 0, "s0000"},
+			{-90, -180, "00000"},
+			{89.99999, 179.99999, "zzzzz"},
+		} {
+			t.Logf("\tTest %d:\tWhen using the position %v, %v.", testID, tt.lat, tt.lon)
+			{
+				if got := geohash.Encode(tt.lat, tt.lon, len(tt.hash)); got != tt.hash {
+					t.Fatalf("\t%s\tTest %d:\tShould get the geohash %s. Got %s.", failed, testID, tt.hash, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the geohash %s.", success, testID, tt.hash)
+
+				// the center of the cell is at most half a cell away from the position
+				lat, lon := geohash.Decode(tt.hash)
+				height, width := geohash.CellSize(len(tt.hash))
+				if math.Abs(lat-tt.lat) > height/2 || math.Abs(lon-tt.lon) > width/2 {
+					t.Fatalf("\t%s\tTest %d:\tShould decode the cell of the position. Got %v, %v.", failed, testID, lat, lon)
+				}
+				if geohash.Encode(lat, lon, len(tt.hash)) != tt.hash {
+					t.Fatalf("\t%s\tTest %d:\tShould encode the decoded center to the same geohash.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould decode the cell of the position.", success, testID)
+			}
+		}
+
+		testID := 6
+		t.Logf("\tTest %d:\tWhen decoding a geohash with an invalid character.", testID)
+		{
+			lat, lon := geohash.Decode("ezs42a")
+			wantLat, wantLon := geohash.Decode("ezs42")
+			if lat != wantLat || lon != wantLon {
+				t.Fatalf("\t%s\tTest %d:\tShould stop at the invalid character. Got %v, %v.", failed, testID, lat, lon)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop at the invalid character.", success, testID)
+		}
+	}
+
+	t.Log("Given the need to find the cells around a cell.")
+	{
+		for testID, tt := range []struct {
+			name       string
+			hash       string
+			neighbours []string
+		}{
+			{"a cell far from the edges", "ezs42", []string{"ezefp", "ezefr", "ezefx", "ezs40", "ezs41", "ezs43", "ezs48", "ezs49"}},
+			{"a cell east of the antimeridian", "8", []string{"2", "3", "9", "b", "c", "r", "x", "z"}},
+			{"a cell west of the antimeridian", "x", []string{"2", "8", "b", "q", "r", "w", "y", "z"}},
+			{"a cell at the north pole", "b", []string{"8", "9", "c", "x", "z"}},
+			{"a cell at the south pole", "0", []string{"1", "2", "3", "p", "r"}},
+			{"a cell at the north pole across the antimeridian", "zzz", []string{"bp8", "bpb", "zzw", "zzx", "zzy"}},
+		} {
+			t.Logf("\tTest %d:\tWhen using %s.", testID, tt.name)
+			{
+				got := geohash.Neighbours(tt.hash)
+				sort.Strings(got)
+				sort.Strings(tt.neighbours)
+
+				if diff := cmp.Diff(tt.neighbours, got); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the cells around %s. Diff:\n%s", failed, testID, tt.hash, diff)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the cells around %s.", success, testID, tt.hash)
+			}
+		}
+	}
+
+	t.Log("Given the need to measure distances.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen measuring known distances.", testID)
+		{
+			// a degree of a great circle and half of the equator
+			for _, tt := range []struct{ lat1, lon1, lat2, lon2, km float64 }{
+				{0, 0, 0, 1, 2 * math.Pi * geohash.EarthRadiusKm / 360},
+				{0, 179.5, 0, -179.5, 2 * math.Pi * geohash.EarthRadiusKm / 360},
+				{0, 0, 0, 180, math.Pi * geohash.EarthRadiusKm},
+				{90, 0, -90, 0, math.Pi * geohash.EarthRadiusKm},
+			} {
+				if got := geohash.Distance(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.km) > 1e-6 {
+					t.Fatalf("\t%s\tTest %d:\tShould get %v km between %v, %v and %v, %v. Got %v.", failed, testID, tt.km, tt.lat1, tt.lon1, tt.lat2, tt.lon2, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the known distances.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package lru provides a bounded least recently used cache whose entries expire
+// after a time to live.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entry is a cached value with the time it expires at.
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// Cache keeps up to size values. Adding a value to a full cache evicts the least
+// recently used one. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // most recently used entries first.
+	items map[K]*list.Element
+}
+
+// New constructs a cache of the size, its values expire after ttl. A size below
+// one is treated as one.
+func New[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Cache[K, V]{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[K]*list.Element, size),
+	}
+}
+
+// Get returns the value of the key if it's cached and not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if !time.Now().Before(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Add caches the value of the key replacing the previous one.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Purge removes all values.
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[K]*list.Element, c.size)
+}
+
+// Len returns the number of cached values including the expired ones which
+// weren't asked for since they expired.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// remove removes the entry of the list element.
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,107 @@
+package lru_test
+
+import (
+	"github.com/mchusovlianov/geodata/foundation/lru"
+	"testing"
+	"time"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func Test_Cache(t *testing.T) {
+	t.Log("Given the need to keep the most recently used values.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen adding values to a full cache.", testID)
+		{
+			c := lru.New[string, int](3, time.Minute)
+			c.Add("a", 1)
+			c.Add("b", 2)
+			c.Add("c", 3)
+
+			// a becomes the most recently used, so b is the first to go
+			if v, ok := c.Get("a"); !ok || v != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould get a cached value. Got %d, %t.", failed, testID, v, ok)
+			}
+			c.Add("d", 4)
+			c.Add("e", 5)
+
+			for key, want := range map[string]bool{"a": true, "b": false, "c": false, "d": true, "e": true} {
+				if _, ok := c.Get(key); ok != want {
+					t.Fatalf("\t%s\tTest %d:\tShould evict the least recently used values, %s cached %t. Got %t.", failed, testID, key, want, ok)
+				}
+			}
+			if c.Len() != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep 3 values. Got %d.", failed, testID, c.Len())
+			}
+			t.Logf("\t%s\tTest %d:\tShould evict the least recently used values.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen adding a value of a cached key.", testID)
+		{
+			c := lru.New[string, int](2, time.Minute)
+			c.Add("a", 1)
+			c.Add("b", 2)
+
+			// replacing a makes it the most recently used without growing the cache
+			c.Add("a", 10)
+			if c.Len() != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep 2 values. Got %d.", failed, testID, c.Len())
+			}
+			c.Add("c", 3)
+
+			if v, ok := c.Get("a"); !ok || v != 10 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the new value. Got %d, %t.", failed, testID, v, ok)
+			}
+			if _, ok := c.Get("b"); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould evict the value not updated.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould replace the value and mark it as recently used.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen constructing a cache of no size.", testID)
+		{
+			c := lru.New[string, int](0, time.Minute)
+			c.Add("a", 1)
+			c.Add("b", 2)
+
+			if c.Len() != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep 1 value. Got %d.", failed, testID, c.Len())
+			}
+			if v, ok := c.Get("b"); !ok || v != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the last value. Got %d, %t.", failed, testID, v, ok)
+			}
+
+			c.Purge()
+			if _, ok := c.Get("b"); ok || c.Len() != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould remove all values once purged.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep a single value.", success, testID)
+		}
+	}
+
+	t.Log("Given the need to expire the cached values.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen getting a value after its time to live.", testID)
+		{
+			c := lru.New[string, int](2, 10*time.Millisecond)
+			c.Add("a", 1)
+			time.Sleep(20 * time.Millisecond)
+
+			if _, ok := c.Get("a"); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould not get an expired value.", failed, testID)
+			}
+			if c.Len() != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould remove the expired value. Got %d values.", failed, testID, c.Len())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not get an expired value.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ErrNoClientIP is returned when the address of the client can't be parsed.
+var ErrNoClientIP = errors.New("no client ip")
+
+// ClientIP returns the address of the client which made the request. The proxy
+// headers Forwarded, X-Forwarded-For and X-Real-IP are only believed when the
+// peer is one of the trusted proxies. Addresses appended by trusted proxies are
+// skipped from the right, the first other one is the client.
+func ClientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, error) {
+	peer, err := parseHostAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: remote address %q", ErrNoClientIP, r.RemoteAddr)
+	}
+
+	if !isTrusted(peer, trusted) {
+		return peer, nil
+	}
+
+	var hops []string
+	switch {
+	case r.Header.Get("Forwarded") != "":
+		hops = forwardedFor(r.Header.Values("Forwarded"))
+	case r.Header.Get("X-Forwarded-For") != "":
+		hops = splitList(r.Header.Values("X-Forwarded-For"))
+	case r.Header.Get("X-Real-IP") != "":
+		hops = []string{r.Header.Get("X-Real-IP")}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHostAddr(hops[i])
+		if err != nil {
+			// a hop the proxies couldn't tell can't be skipped
+			return netip.Addr{}, fmt.Errorf("%w: forwarded address %q", ErrNoClientIP, hops[i])
+		}
+
+		client = addr
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+
+	return client, nil
+}
+
+// isTrusted tells if the address belongs to one of the prefixes.
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedFor returns the for parameters of the Forwarded header elements, see
+// RFC 7239.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops = append(hops, strings.Trim(value, `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// splitList splits comma separated values of headers.
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
+
+// parseHostAddr parses an address which may have a port, IPv6 addresses with a
+// port are in brackets. Zones are dropped and IPv4-mapped IPv6 addresses are
+// converted to IPv4 ones.
+func parseHostAddr(s string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.WithZone("").Unmap(), nil
+	}
+
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		// an IPv6 address in brackets without a port
+		host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.WithZone("").Unmap(), nil
+}
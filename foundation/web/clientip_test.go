@@ -0,0 +1,97 @@
+package web_test
+
+import (
+	"errors"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func Test_ClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	t.Log("Given the need to tell the address of the client.")
+	{
+		for testID, tt := range []struct {
+			name    string
+			remote  string
+			headers http.Header
+			want    string
+		}{
+			{"a direct request", "203.0.113.7:4711", nil, "203.0.113.7"},
+			{"an untrusted peer sending proxy headers", "203.0.113.7:4711", http.Header{"X-Forwarded-For": {"1.1.1.1"}, "Forwarded": {"for=1.1.1.1"}, "X-Real-Ip": {"1.1.1.1"}}, "203.0.113.7"},
+			{"an untrusted peer sending malformed headers", "203.0.113.7:4711", http.Header{"X-Forwarded-For": {"garbage"}}, "203.0.113.7"},
+			{"a trusted peer without proxy headers", "10.0.0.1:4711", nil, "10.0.0.1"},
+			{"a spoofed leftmost X-Forwarded-For entry", "10.0.0.1:4711", http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.7"}}, "203.0.113.7"},
+			{"a chain of trusted proxies", "10.0.0.1:4711", http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.7, 10.0.0.2, 10.0.0.3"}}, "203.0.113.7"},
+			{"X-Forwarded-For headers repeated", "10.0.0.1:4711", http.Header{"X-Forwarded-For": {"1.1.1.1", "203.0.113.7"}}, "203.0.113.7"},
+			{"only trusted hops", "10.0.0.1:4711", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+			{"a spoofed leftmost Forwarded element", "10.0.0.1:4711", http.Header{"Forwarded": {`for=1.1.1.1, for=203.0.113.7;proto=https`}}, "203.0.113.7"},
+			{"Forwarded over X-Forwarded-For", "10.0.0.1:4711", http.Header{"Forwarded": {"for=203.0.113.7"}, "X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+			{"Forwarded with an IPv6 address in brackets and a port", "10.0.0.1:4711", http.Header{"Forwarded": {`proto=https;For="[2001:db8::1]:4711"`}}, "2001:db8::1"},
+			{"X-Real-IP", "10.0.0.1:4711", http.Header{"X-Real-Ip": {"203.0.113.7"}}, "203.0.113.7"},
+			{"X-Real-IP with an IPv6 address in brackets", "10.0.0.1:4711", http.Header{"X-Real-Ip": {"[2001:db8::1]"}}, "2001:db8::1"},
+			{"a trusted IPv6 peer with a port", "[::1]:4711", http.Header{"X-Forwarded-For": {"203.0.113.7:80"}}, "203.0.113.7"},
+			{"an IPv6 hop with a zone", "[::1]:4711", http.Header{"X-Forwarded-For": {"fe80::1%eth0"}}, "fe80::1"},
+			{"an IPv4-mapped IPv6 peer", "[::ffff:10.0.0.1]:4711", http.Header{"X-Forwarded-For": {"::ffff:203.0.113.7"}}, "203.0.113.7"},
+		} {
+			t.Logf("\tTest %d:\tWhen handling %s.", testID, tt.name)
+			{
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = tt.remote
+				if tt.headers != nil {
+					r.Header = tt.headers
+				}
+
+				got, err := web.ClientIP(r, trusted)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to tell the address: %v.", failed, testID, err)
+				}
+				if got != netip.MustParseAddr(tt.want) {
+					t.Fatalf("\t%s\tTest %d:\tShould get %s. Got %s.", failed, testID, tt.want, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %s.", success, testID, tt.want)
+			}
+		}
+	}
+
+	t.Log("Given the need to reject addresses which can't be told.")
+	{
+		for testID, tt := range []struct {
+			name    string
+			remote  string
+			headers http.Header
+		}{
+			{"a malformed remote address", "somewhere", nil},
+			{"a malformed X-Forwarded-For entry", "10.0.0.1:4711", http.Header{"X-Forwarded-For": {"203.0.113.7, garbage"}}},
+			{"an obfuscated Forwarded identifier", "10.0.0.1:4711", http.Header{"Forwarded": {"for=_hidden"}}},
+			{"an unknown Forwarded identifier", "10.0.0.1:4711", http.Header{"Forwarded": {"for=unknown"}}},
+			{"an IPv6 address with a port and no brackets", "10.0.0.1:4711", http.Header{"X-Real-Ip": {"2001:db8::1:80:"}}},
+		} {
+			t.Logf("\tTest %d:\tWhen handling %s.", testID, tt.name)
+			{
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = tt.remote
+				if tt.headers != nil {
+					r.Header = tt.headers
+				}
+
+				if got, err := web.ClientIP(r, trusted); !errors.Is(err, web.ErrNoClientIP) {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to tell the address. Got %s, %v.", failed, testID, got, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not be able to tell the address.", success, testID)
+			}
+		}
+	}
+}
@@ -20,7 +20,7 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 			if err := handler(ctx, w, r); err != nil {
 
 				// Log the error.
-				log.Errorw("ERROR", "message", err)
+				log.Errorw("ERROR", "traceid", web.GetTraceID(ctx), "message", err)
 
 				// Build out the error response.
 				var er web.ErrorResponse
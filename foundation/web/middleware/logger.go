@@ -5,10 +5,11 @@ import (
 	"github.com/mchusovlianov/geodata/foundation/web"
 	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
-// Logger writes some information about the request to the logs in the
-// format: TraceID : (200) GET /foo -> IP ADDR (latency)
+// Logger writes a line about the request to the logs when it starts and another
+// one with its status code and latency when it completes, both with its trace id.
 func Logger(log *zap.SugaredLogger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
@@ -17,11 +18,19 @@ func Logger(log *zap.SugaredLogger) web.Middleware {
 		// Create the handler that will be attached in the middleware chain.
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
-			log.Infow("request", "method", r.Method, "path", r.URL.Path,
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Infow("request started", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
 				"remoteaddr", r.RemoteAddr)
 
 			// Call the next handler.
-			err := handler(ctx, w, r)
+			err = handler(ctx, w, r)
+
+			log.Infow("request completed", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
+				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now))
 
 			// Return the error so it can be handled further up the chain.
 			return err
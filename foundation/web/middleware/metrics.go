@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"github.com/mchusovlianov/geodata/foundation/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics records the number of requests by route, method and status code and
+// their latencies by route and method into collectors registered with reg. It
+// has to run outside of the Errors middleware to see the status codes of
+// failed requests.
+func Metrics(reg prometheus.Registerer) web.Middleware {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of handled requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	latencies := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latencies of handled requests by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	reg.MustRegister(requests, latencies)
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return err
+			}
+
+			// Call the next handler.
+			err = handler(ctx, w, r)
+
+			// a handler responding without web.Respond gets the implicit 200
+			status := v.StatusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := web.Route(r)
+			requests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+			latencies.WithLabelValues(route, r.Method).Observe(time.Since(v.Now).Seconds())
+
+			// Return the error so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
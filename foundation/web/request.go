@@ -1,6 +1,8 @@
 package web
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/dimfeld/httptreemux/v5"
 	"net/http"
 )
@@ -10,3 +12,21 @@ func Param(r *http.Request, key string) string {
 	m := httptreemux.ContextParams(r.Context())
 	return m[key]
 }
+
+// Route returns the route pattern the request matched, like /v1/location/:ip,
+// so requests of a route can be told apart from the values of its parameters.
+func Route(r *http.Request) string {
+	return httptreemux.ContextRoute(r.Context())
+}
+
+// Decode reads the body of an HTTP request looking for a JSON document. The
+// body is decoded into the provided value. Unknown fields are rejected.
+func Decode(r *http.Request, val any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(val); err != nil {
+		return fmt.Errorf("decoding request body: %w", err)
+	}
+
+	return nil
+}
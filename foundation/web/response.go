@@ -8,6 +8,11 @@ import (
 
 // Respond converts a Go value to JSON and sends it to the client.
 func Respond(ctx context.Context, w http.ResponseWriter, data any, statusCode int) error {
+	// Set the status code for the request logger middleware.
+	if err := SetStatusCode(ctx, statusCode); err != nil {
+		return err
+	}
+
 	// If there is nothing to marshal then set status code and return.
 	if statusCode == http.StatusNoContent {
 		w.WriteHeader(statusCode)
@@ -3,10 +3,71 @@ package web
 
 import (
 	"context"
+	"errors"
 	"github.com/dimfeld/httptreemux/v5"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"time"
 )
 
+// tracer starts the spans of the package.
+var tracer = otel.Tracer("github.com/mchusovlianov/geodata/foundation/web")
+
+// RequestIDHeader carries the trace id of a request. An id sent by the client,
+// e.g. by a proxy in front of the api, is kept, otherwise a new one is made; the
+// response echoes it.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds the length of a request id sent by the client.
+const maxRequestIDLen = 128
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// key is how request values are stored/retrieved.
+const key ctxKey = 1
+
+// Values represent state for each request.
+type Values struct {
+	TraceID    string
+	Now        time.Time
+	StatusCode int
+}
+
+// GetValues returns the values from the context.
+func GetValues(ctx context.Context) (*Values, error) {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return nil, errors.New("web value missing from context")
+	}
+	return v, nil
+}
+
+// GetTraceID returns the trace id from the context, empty outside of a request.
+func GetTraceID(ctx context.Context) string {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return ""
+	}
+	return v.TraceID
+}
+
+// SetStatusCode sets the status code back into the context.
+func SetStatusCode(ctx context.Context, statusCode int) error {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return errors.New("web value missing from context")
+	}
+	v.StatusCode = statusCode
+	return nil
+}
+
 // A Handler is a type that handles a http request within our own little mini
 // framework.
 type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request) error
@@ -43,22 +104,73 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 	// Add the application's general middleware to the handler chain.
 	handler = wrapMiddleware(a.mw, handler)
 
+	finalPath := path
+	if group != "" {
+		finalPath = "/" + group + path
+	}
+
 	// The function to execute for each request.
 	h := func(w http.ResponseWriter, r *http.Request) {
 
-		// Pull the context from the request and
-		// use it as a separate parameter.
-		ctx := r.Context()
+		// Continue the trace of the caller given by the W3C trace context
+		// headers, the span of the request is the parent of the spans
+		// started with the context down the call chain.
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, method+" "+finalPath,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(method), semconv.HTTPRouteKey.String(finalPath)),
+		)
+		defer span.End()
 
-		// Call the wrapped handler functions.
-		if err := handler(ctx, w, r); err != nil {
-			return
+		// Set the context with the required values to
+		// process the request.
+		v := Values{
+			TraceID: requestID(r, span.SpanContext()),
+			Now:     time.Now().UTC(),
 		}
-	}
+		ctx = context.WithValue(ctx, key, &v)
 
-	finalPath := path
-	if group != "" {
-		finalPath = "/" + group + path
+		w.Header().Set(RequestIDHeader, v.TraceID)
+		span.SetAttributes(attribute.String("http.request_id", v.TraceID))
+
+		// Call the wrapped handler functions, the error middleware has
+		// already responded to their errors.
+		handler(ctx, w, r)
+
+		if v.StatusCode != 0 {
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(v.StatusCode))
+		}
+		if v.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(v.StatusCode))
+		}
 	}
+
 	a.mux.Handle(method, finalPath, h)
 }
+
+// requestID returns the request id sent by the client if it is short and
+// printable, so it can't forge log lines. Otherwise it is the id of the trace
+// of the request, so logs lead to the trace, or a new one if nothing is traced.
+func requestID(r *http.Request, sc trace.SpanContext) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLen {
+		return newRequestID(sc)
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return newRequestID(sc)
+		}
+	}
+
+	return id
+}
+
+// newRequestID returns the id of the trace or a new uuid without a trace.
+func newRequestID(sc trace.SpanContext) string {
+	if sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+
+	return uuid.NewString()
+}